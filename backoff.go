@@ -0,0 +1,72 @@
+package hms
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// BackoffPolicy decides how long transport waits before retrying failed request
+type BackoffPolicy interface {
+	// Backoff returns delay before retry attempt. Attempt starts from 1,
+	// previous is delay returned for previous attempt or zero for the first one
+	Backoff(attempt int, previous time.Duration) time.Duration
+}
+
+// ConstantBackoff waits the same interval before every retry
+type ConstantBackoff struct {
+	interval time.Duration
+}
+
+func NewConstantBackoff(interval time.Duration) *ConstantBackoff {
+	return &ConstantBackoff{interval: interval}
+}
+
+func (b *ConstantBackoff) Backoff(attempt int, previous time.Duration) time.Duration {
+	return b.interval
+}
+
+// ExponentialBackoff doubles delay with every retry starting from base interval, but not more than max interval
+type ExponentialBackoff struct {
+	base time.Duration
+	max  time.Duration
+}
+
+func NewExponentialBackoff(base, max time.Duration) *ExponentialBackoff {
+	return &ExponentialBackoff{base: base, max: max}
+}
+
+func (b *ExponentialBackoff) Backoff(attempt int, previous time.Duration) time.Duration {
+	delay := float64(b.base) * math.Pow(2, float64(attempt-1))
+	if delay > float64(b.max) {
+		return b.max
+	}
+	return time.Duration(delay)
+}
+
+// DecorrelatedJitterBackoff picks random delay between base interval and three times previous delay,
+// but not more than max interval. Randomization spreads retries of concurrent clients
+type DecorrelatedJitterBackoff struct {
+	base time.Duration
+	max  time.Duration
+}
+
+func NewDecorrelatedJitterBackoff(base, max time.Duration) *DecorrelatedJitterBackoff {
+	return &DecorrelatedJitterBackoff{base: base, max: max}
+}
+
+func (b *DecorrelatedJitterBackoff) Backoff(attempt int, previous time.Duration) time.Duration {
+	if previous < b.base {
+		previous = b.base
+	}
+
+	delay := b.base
+	if spread := int64(previous*3 - b.base); spread > 0 {
+		delay += time.Duration(rand.Int63n(spread))
+	}
+
+	if delay > b.max {
+		return b.max
+	}
+	return delay
+}
@@ -0,0 +1,69 @@
+package hms
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConstantBackoff(t *testing.T) {
+	b := NewConstantBackoff(time.Second)
+	for attempt := 1; attempt <= 3; attempt++ {
+		if delay := b.Backoff(attempt, time.Minute); delay != time.Second {
+			t.Fatalf("attempt %d delay = %v, want %v", attempt, delay, time.Second)
+		}
+	}
+}
+
+func TestExponentialBackoff(t *testing.T) {
+	b := NewExponentialBackoff(100*time.Millisecond, time.Second)
+
+	want := []time.Duration{100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond, time.Second, time.Second}
+	var delay time.Duration
+	for i, w := range want {
+		delay = b.Backoff(i+1, delay)
+		if delay != w {
+			t.Fatalf("attempt %d delay = %v, want %v", i+1, delay, w)
+		}
+	}
+
+	// large attempt number doesn't overflow
+	if delay := b.Backoff(100, 0); delay != time.Second {
+		t.Fatalf("attempt 100 delay = %v, want %v", delay, time.Second)
+	}
+}
+
+func TestDecorrelatedJitterBackoff(t *testing.T) {
+	base, max := 100*time.Millisecond, time.Second
+	b := NewDecorrelatedJitterBackoff(base, max)
+
+	var delay time.Duration
+	for attempt := 1; attempt <= 100; attempt++ {
+		previous := delay
+		if previous < base {
+			previous = base
+		}
+
+		delay = b.Backoff(attempt, delay)
+		if delay < base || delay > max || delay > 3*previous {
+			t.Fatalf("attempt %d delay = %v, want between %v and %v", attempt, delay, base, 3*previous)
+		}
+	}
+}
+
+func TestLegacyConstructorsBackoff(t *testing.T) {
+	tr, err := NewHTTPTransport(DefaultRetryCount, DefaultRetryIntervalMs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tr.backoff.(*ExponentialBackoff); !ok {
+		t.Fatalf("backoff = %T, want exponential backoff for zero interval", tr.backoff)
+	}
+
+	tr, err = NewHTTPTransportWithProxy(DefaultRetryCount, 50, "http://proxy.example.com:3128")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if delay := tr.backoff.Backoff(3, 0); delay != 50*time.Millisecond {
+		t.Fatalf("delay = %v, want constant 50ms", delay)
+	}
+}
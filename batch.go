@@ -0,0 +1,160 @@
+package hms
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// BatchResult represents aggregated result of sending message to large list of tokens
+type BatchResult struct {
+	// Number of tokens message was sent to.
+	SuccessCount int
+
+	// Number of tokens message failed to be sent to.
+	FailureCount int
+
+	// Outcome for every token in the same order tokens were passed.
+	Results []TokenResult
+
+	// Push server responses for every chunk in order of chunks. Nil for chunks failed before getting response.
+	Responses []*HuaweiResponse
+}
+
+// TokenResult represents outcome of sending message to single token
+type TokenResult struct {
+	// Device token.
+	Token string
+
+	// Result code of request which contained token. Empty if request failed before getting response.
+	Code ResponseCode
+
+	// Error of sending message to token, nil if message was sent.
+	Err error
+}
+
+// Success reports whether message was sent to token
+func (r TokenResult) Success() bool {
+	return r.Err == nil
+}
+
+// SendBatch sends message to arbitrary number of tokens. Tokens are split into chunks of
+// MaxTokensPerRequest which are sent concurrently, see SetBatchConcurrency.
+// Message must not contain target, tokens are set for every chunk separately.
+// Errors of separate chunks are reported in result, error is returned only for invalid input.
+// If context is done, chunks which weren't sent yet are reported with context error
+func (c *HuaweiClient) SendBatch(ctx context.Context, msgRequest *HuaweiMessage, tokens []string) (*BatchResult, error) {
+	if len(tokens) == 0 {
+		return nil, errors.New("tokens can't be empty")
+	}
+
+	if msgRequest == nil || msgRequest.Message == nil {
+		return nil, errors.New("message can't be empty")
+	}
+
+	if msgRequest.Message.Token != nil || msgRequest.Message.Topic != "" || msgRequest.Message.Condition != "" {
+		return nil, errors.New("message target must be empty, tokens are set by batch")
+	}
+
+	var chunks [][]string
+	for start := 0; start < len(tokens); start += MaxTokensPerRequest {
+		end := start + MaxTokensPerRequest
+		if end > len(tokens) {
+			end = len(tokens)
+		}
+		chunks = append(chunks, tokens[start:end])
+	}
+
+	// validation fills defaults of nested structures shared by chunks,
+	// so it's done once before concurrent sending
+	if err := chunkMessage(msgRequest, chunks[0]).Validate(); err != nil {
+		return nil, err
+	}
+
+	c.metrics.ObserveBatchSize(len(tokens))
+
+	result := &BatchResult{
+		Results:   make([]TokenResult, len(tokens)),
+		Responses: make([]*HuaweiResponse, len(chunks)),
+	}
+
+	sem := make(chan struct{}, c.batchConcurrency)
+	var wg sync.WaitGroup
+	for i, chunk := range chunks {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+		}
+
+		// chunks which weren't started fail with context error
+		if err := ctx.Err(); err != nil {
+			for j := i; j < len(chunks); j++ {
+				fillTokenResults(result.Results[j*MaxTokensPerRequest:], chunks[j], nil, err)
+			}
+			break
+		}
+
+		wg.Add(1)
+
+		go func(i int, chunk []string) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+
+			resp, err := c.SendMessage(ctx, chunkMessage(msgRequest, chunk))
+			result.Responses[i] = resp
+			fillTokenResults(result.Results[i*MaxTokensPerRequest:], chunk, resp, err)
+		}(i, chunk)
+	}
+	wg.Wait()
+
+	for _, r := range result.Results {
+		if r.Success() {
+			result.SuccessCount++
+		} else {
+			result.FailureCount++
+		}
+	}
+
+	return result, nil
+}
+
+// chunkMessage returns copy of message targeted to tokens of chunk
+func chunkMessage(msgRequest *HuaweiMessage, chunk []string) *HuaweiMessage {
+	message := *msgRequest.Message
+	message.Token = chunk
+
+	return &HuaweiMessage{
+		ValidateOnly: msgRequest.ValidateOnly,
+		Message:      &message,
+	}
+}
+
+// fillTokenResults sets outcome of every token of chunk according to chunk response
+func fillTokenResults(results []TokenResult, chunk []string, resp *HuaweiResponse, err error) {
+	if resp != nil {
+		err = resp.Err()
+	}
+
+	var illegal map[string]bool
+	if resp != nil && resp.Partial != nil {
+		illegal = make(map[string]bool, len(resp.Partial.IllegalTokens))
+		for _, token := range resp.Partial.IllegalTokens {
+			illegal[token] = true
+		}
+	}
+
+	for i, token := range chunk {
+		results[i] = TokenResult{Token: token, Err: err}
+		if resp != nil {
+			results[i].Code = resp.Code
+		}
+
+		// only listed tokens failed in partially successful request
+		if illegal != nil && !illegal[token] {
+			results[i].Code = SuccessCode
+			results[i].Err = nil
+		}
+	}
+}
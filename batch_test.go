@@ -0,0 +1,91 @@
+package hms_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	hms "github.com/icecream78/go-hms-push"
+	"github.com/icecream78/go-hms-push/hmstest"
+)
+
+func batchTokens(n int) []string {
+	tokens := make([]string, n)
+	for i := range tokens {
+		tokens[i] = fmt.Sprintf("token-%d", i)
+	}
+	return tokens
+}
+
+func batchMessage() *hms.HuaweiMessage {
+	msg := hms.GetDefaultAndroidNotificationMessage(nil)
+	msg.Message.Token = nil
+	return msg
+}
+
+func TestSendBatch(t *testing.T) {
+	server := hmstest.NewServer("app", "secret")
+	defer server.Close()
+
+	client, err := hms.NewHuaweiClient("app", "secret", hms.WithBaseURL(server.URL), hms.WithBatchConcurrency(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tokens := batchTokens(2*hms.MaxTokensPerRequest + 1)
+	server.Enqueue(hmstest.PartialSuccess(hms.MaxTokensPerRequest-1, tokens[0]))
+
+	result, err := client.SendBatch(context.Background(), batchMessage(), tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(server.Messages()); n != 3 {
+		t.Fatalf("server received %d messages, want 3", n)
+	}
+	if result.SuccessCount != len(tokens)-1 || result.FailureCount != 1 {
+		t.Fatalf("success = %d, failure = %d, want %d and 1", result.SuccessCount, result.FailureCount, len(tokens)-1)
+	}
+}
+
+func TestSendBatchEmptyMessage(t *testing.T) {
+	client, err := hms.NewHuaweiClient("app", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := client.SendBatch(context.Background(), nil, []string{"token"}); err == nil {
+		t.Fatal("expected error for empty message")
+	}
+}
+
+func TestSendBatchCancelled(t *testing.T) {
+	server := hmstest.NewServer("app", "secret")
+	defer server.Close()
+
+	client, err := hms.NewHuaweiClient("app", "secret", hms.WithBaseURL(server.URL), hms.WithBatchConcurrency(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	tokens := batchTokens(3 * hms.MaxTokensPerRequest)
+	result, err := client.SendBatch(ctx, batchMessage(), tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n := len(server.Messages()); n != 0 {
+		t.Fatalf("server received %d messages, want 0", n)
+	}
+	if result.FailureCount != len(tokens) {
+		t.Fatalf("failure count = %d, want %d", result.FailureCount, len(tokens))
+	}
+	for _, r := range result.Results {
+		if r.Err != context.Canceled || r.Token == "" {
+			t.Fatalf("token result = %+v, want context.Canceled", r)
+		}
+	}
+}
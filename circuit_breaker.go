@@ -0,0 +1,238 @@
+package hms
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without sending request while circuit breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// CircuitState is state of circuit breaker
+type CircuitState int
+
+const (
+	// CircuitClosed lets all requests through and counts consecutive failures
+	CircuitClosed CircuitState = iota
+
+	// CircuitOpen rejects all requests until open timeout passes
+	CircuitOpen
+
+	// CircuitHalfOpen lets single probe request through to check whether server recovered
+	CircuitHalfOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitClosed:
+		return "closed"
+	case CircuitOpen:
+		return "open"
+	case CircuitHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+// CircuitStateHandler is called when circuit breaker changes its state
+type CircuitStateHandler func(from, to CircuitState)
+
+// CircuitBreaker stops sending requests to server after consecutive failures: 5xx responses,
+// network errors and timeouts or InternalErrorCode result. After open timeout single probe request
+// is let through, its success closes circuit and failure opens it again
+type CircuitBreaker struct {
+	mu sync.Mutex
+
+	failureThreshold int
+	openTimeout      time.Duration
+	onStateChange    CircuitStateHandler
+
+	// requests to other URLs aren't checked, empty prefix means all requests
+	urlPrefix string
+
+	state    CircuitState
+	failures int
+	openedAt time.Time
+	// probe request is in flight in half-open state
+	probing bool
+}
+
+// stateChange is transition made under lock, handler is notified after lock is released
+type stateChange struct {
+	from, to CircuitState
+	handler  CircuitStateHandler
+}
+
+func (c *stateChange) notify() {
+	if c != nil && c.handler != nil {
+		c.handler(c.from, c.to)
+	}
+}
+
+// NewCircuitBreaker creates circuit breaker which opens after failureThreshold consecutive failures
+// and stays open for openTimeout
+func NewCircuitBreaker(failureThreshold int, openTimeout time.Duration) (*CircuitBreaker, error) {
+	if failureThreshold < 1 {
+		return nil, errors.New("failure threshold must be positive")
+	}
+
+	if openTimeout <= 0 {
+		return nil, errors.New("open timeout must be positive")
+	}
+
+	return &CircuitBreaker{
+		failureThreshold: failureThreshold,
+		openTimeout:      openTimeout,
+	}, nil
+}
+
+// SetStateChangeHandler sets handler which is called synchronously on every state change.
+// Handler is called without holding breaker lock, so it may call State
+func (cb *CircuitBreaker) SetStateChangeHandler(handler CircuitStateHandler) error {
+	if handler == nil {
+		return errors.New("passed empty state change handler")
+	}
+
+	cb.mu.Lock()
+	cb.onStateChange = handler
+	cb.mu.Unlock()
+
+	return nil
+}
+
+// SetURLPrefix limits circuit breaker to requests which URL starts with prefix.
+// Without it oauth and push requests of client share the breaker, so failures
+// of token endpoint open it for push requests too
+func (cb *CircuitBreaker) SetURLPrefix(prefix string) error {
+	if prefix == "" {
+		return errors.New("passed empty url prefix")
+	}
+
+	cb.mu.Lock()
+	cb.urlPrefix = prefix
+	cb.mu.Unlock()
+
+	return nil
+}
+
+// applies reports whether request to url is checked by circuit breaker
+func (cb *CircuitBreaker) applies(url string) bool {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	return strings.HasPrefix(url, cb.urlPrefix)
+}
+
+// State returns current state of circuit breaker
+func (cb *CircuitBreaker) State() CircuitState {
+	cb.mu.Lock()
+	defer cb.mu.Unlock()
+
+	if cb.state == CircuitOpen && time.Since(cb.openedAt) >= cb.openTimeout {
+		return CircuitHalfOpen
+	}
+	return cb.state
+}
+
+// allow reports whether request can be sent
+func (cb *CircuitBreaker) allow() error {
+	cb.mu.Lock()
+	var change *stateChange
+	defer func() {
+		cb.mu.Unlock()
+		change.notify()
+	}()
+
+	switch cb.state {
+	case CircuitOpen:
+		if time.Since(cb.openedAt) < cb.openTimeout {
+			return ErrCircuitOpen
+		}
+		change = cb.setState(CircuitHalfOpen)
+		cb.probing = true
+		return nil
+	case CircuitHalfOpen:
+		if cb.probing {
+			return ErrCircuitOpen
+		}
+		cb.probing = true
+		return nil
+	}
+	return nil
+}
+
+// record updates state with result of allowed request
+func (cb *CircuitBreaker) record(success bool) {
+	cb.mu.Lock()
+	var change *stateChange
+	defer func() {
+		cb.mu.Unlock()
+		change.notify()
+	}()
+
+	cb.probing = false
+	if success {
+		cb.failures = 0
+		change = cb.setState(CircuitClosed)
+		return
+	}
+
+	cb.failures++
+	if cb.state == CircuitHalfOpen || cb.failures >= cb.failureThreshold {
+		cb.openedAt = time.Now()
+		change = cb.setState(CircuitOpen)
+	}
+}
+
+// release lets next probe through after allowed request ended without result, for example
+// was cancelled by caller. Failure count and state are kept as is
+func (cb *CircuitBreaker) release() {
+	cb.mu.Lock()
+	cb.probing = false
+	cb.mu.Unlock()
+}
+
+// setState changes state and returns transition to notify handler about. Caller must hold mu
+func (cb *CircuitBreaker) setState(state CircuitState) *stateChange {
+	if cb.state == state {
+		return nil
+	}
+
+	change := &stateChange{from: cb.state, to: state, handler: cb.onStateChange}
+	cb.state = state
+	return change
+}
+
+// isFailure reports whether result of request attempt means server is unavailable.
+// Response body is read to check result code and replaced with its copy
+func (cb *CircuitBreaker) isFailure(resp *HttpResponse, err error) bool {
+	if err != nil {
+		return true
+	}
+
+	if resp.Status >= http.StatusInternalServerError {
+		return true
+	}
+
+	if resp.Status != http.StatusOK || resp.Body == nil {
+		return false
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+	if err != nil {
+		return true
+	}
+
+	var result struct {
+		Code ResponseCode `json:"code"`
+	}
+	return json.Unmarshal(data, &result) == nil && result.Code == InternalErrorCode
+}
@@ -0,0 +1,127 @@
+package hms
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func newBreakerTransport(t *testing.T, cb *CircuitBreaker) *HttpTransport {
+	t.Helper()
+
+	tr, err := NewTransport(TransportRetryCount(1), TransportCircuitBreaker(cb))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return tr
+}
+
+func TestCircuitBreakerHandlerCanReadState(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	cb, err := NewCircuitBreaker(1, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var states []CircuitState
+	cb.SetStateChangeHandler(func(from, to CircuitState) {
+		states = append(states, cb.State())
+	})
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		newBreakerTransport(t, cb).Send(context.Background(), NewHTTPRequest().SetMethod(http.MethodPost).SetURL(server.URL))
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("send is blocked by state change handler")
+	}
+
+	if len(states) != 1 || states[0] != CircuitOpen {
+		t.Fatalf("states seen by handler = %v, want [open]", states)
+	}
+}
+
+func TestCircuitBreakerCancelledProbeKeepsCircuitOpen(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	defer close(release)
+
+	cb, err := NewCircuitBreaker(1, 10*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := newBreakerTransport(t, cb)
+
+	// open circuit with single failure
+	cb.record(false)
+	time.Sleep(20 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		cancel()
+	}()
+	if _, err := tr.Send(ctx, NewHTTPRequest().SetMethod(http.MethodPost).SetURL(server.URL)); err == nil {
+		t.Fatal("expected error of cancelled request")
+	}
+
+	if state := cb.State(); state != CircuitHalfOpen {
+		t.Fatalf("state after cancelled probe = %s, want half-open", state)
+	}
+
+	// next probe is let through after cancelled one
+	if err := cb.allow(); err != nil {
+		t.Fatalf("probe after cancelled one isn't allowed: %v", err)
+	}
+}
+
+func TestCircuitBreakerCancellationKeepsFailureCount(t *testing.T) {
+	cb, err := NewCircuitBreaker(2, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cb.record(false)
+	cb.release()
+	cb.record(false)
+
+	if state := cb.State(); state != CircuitOpen {
+		t.Fatalf("state = %s, want open", state)
+	}
+}
+
+func TestCircuitBreakerURLPrefix(t *testing.T) {
+	cb, err := NewCircuitBreaker(1, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := cb.SetURLPrefix("https://push.example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	if cb.applies("https://oauth.example.com/oauth2/v3/token") {
+		t.Fatal("breaker applies to url outside of prefix")
+	}
+
+	if !cb.applies("https://push.example.com/v1/app/messages:send") {
+		t.Fatal("breaker doesn't apply to url with prefix")
+	}
+}
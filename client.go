@@ -6,141 +6,504 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
-	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 type Transporter interface {
 	Send(ctx context.Context, req *HttpRequest) (*HttpResponse, error)
 }
 
-type TokenMsg struct {
-	AccessToken      string `json:"access_token"`
-	ExpiresIn        int    `json:"expires_in"`
-	Scope            string `json:"scope"`
-	Error            string `json:"error"`
-	ErrorDescription string `json:"error_description"`
-}
+// InvalidTokenHandler is called with device tokens which push server reported as invalid,
+// so they can be removed from application storage
+type InvalidTokenHandler func(ctx context.Context, tokens []string)
 
+// HuaweiClient is safe for concurrent use by multiple goroutines once configured.
+// Setters must not be called while messages are being sent.
 type HuaweiClient struct {
 	appId     string
-	token     string
-	appSecret string
-	client    Transporter
+	endpoints Endpoints
+	// transport wrapped with middlewares, used to send all requests
+	client Transporter
+	// transport set by caller or created by default
+	transport   Transporter
+	middlewares []Middleware
+	tokenSource TokenSource
+	logger      Logger
+	metrics     Metrics
+	tracer      Tracer
+	// optional storage to share tokens between client instances
+	tokenStore TokenStore
+
+	// guards token, tokenExpiry, tokenIssuedAt and tokenRefreshMargin
+	tokenMu sync.RWMutex
+	token   string
+	// moment when current token stops being valid, zero if unknown
+	tokenExpiry time.Time
+	// moment when current token was issued
+	tokenIssuedAt time.Time
+	// how long before expiry token should be refreshed
+	tokenRefreshMargin time.Duration
+
+	// semaphore which allows only one token refresh in flight
+	refreshSem chan struct{}
+
+	// return non-success response codes as HMSError
+	hmsErrors bool
+
+	// optional handler of invalid device tokens
+	invalidTokenHandler InvalidTokenHandler
+
+	// max number of chunks sent concurrently by SendBatch
+	batchConcurrency int
+
+	// optional limiters of push and oauth requests
+	pushLimiter *RateLimiter
+	authLimiter *RateLimiter
+
+	// options of default transport, used only while client is constructed
+	transportOpts []TransportOption
 }
 
 // NewClient creates a instance of the huawei cloud common client
 // It's contained in huawei cloud app and provides service through huawei cloud app
-func NewHuaweiClient(appId, appSecret string) (*HuaweiClient, error) {
+func NewHuaweiClient(appId, appSecret string, opts ...Option) (*HuaweiClient, error) {
 	if appId == "" {
 		return nil, errors.New("appId can't be empty")
 	}
 
-	client, err := NewHTTPTransport(DefaultRetryCount, DefaultRetryIntervalMs)
-	if err != nil {
-		return nil, errors.New("failed to get http client")
+	c := &HuaweiClient{
+		appId:              appId,
+		endpoints:          DefaultEndpoints,
+		logger:             nopLogger{},
+		metrics:            nopMetrics{},
+		tracer:             nopTracer{},
+		tokenRefreshMargin: DefaultTokenRefreshMargin,
+		refreshSem:         make(chan struct{}, 1),
+		batchConcurrency:   DefaultBatchConcurrency,
 	}
 
-	return &HuaweiClient{
-		appId:     appId,
-		appSecret: appSecret,
-		client:    client,
-	}, nil
-}
+	for _, opt := range opts {
+		if err := opt(c); err != nil {
+			return nil, err
+		}
+	}
 
-func NewHuaweiClientWithTransport(appId, appSecret string, transport Transporter) (*HuaweiClient, error) {
-	client, err := NewHuaweiClient(appId, appSecret)
-	if err != nil {
-		return nil, err
+	if c.transport != nil && c.transportOpts != nil {
+		return nil, errors.New("transport options can't be used with custom transport")
 	}
 
-	if err := client.SetTransport(transport); err != nil {
-		return nil, err
+	if c.transport == nil {
+		// transport options may override logger, metrics and tracer of client
+		defaults := []TransportOption{TransportLogger(c.logger), TransportMetrics(c.metrics), TransportTracer(c.tracer)}
+		transport, err := NewTransport(append(defaults, c.transportOpts...)...)
+		if err != nil {
+			return nil, err
+		}
+		c.transport = transport
 	}
+	c.client = Chain(c.transport, c.middlewares...)
+
+	if c.tokenSource == nil {
+		c.tokenSource = &clientCredentialsTokenSource{
+			appId:     appId,
+			appSecret: appSecret,
+			authURL:   c.endpoints.AuthURL,
+			transport: c.client,
+		}
+	}
+
+	return c, nil
+}
+
+func NewHuaweiClientWithTransport(appId, appSecret string, transport Transporter) (*HuaweiClient, error) {
+	return NewHuaweiClient(appId, appSecret, WithTransport(transport))
+}
 
-	return client, nil
+// NewHuaweiClientWithTokenSource creates client which takes access tokens from provided source
+// instead of requesting them from huawei oauth server
+func NewHuaweiClientWithTokenSource(appId string, tokenSource TokenSource) (*HuaweiClient, error) {
+	return NewHuaweiClient(appId, "", WithTokenSource(tokenSource))
 }
 
 func (c *HuaweiClient) SetTransport(transport Transporter) error {
 	if transport == nil {
 		return errors.New("passed empty transport")
 	}
-	c.client = transport
+	c.transport = transport
+	c.client = Chain(transport, c.middlewares...)
+
+	// default token source must use same transport as client
+	if source, ok := c.tokenSource.(*clientCredentialsTokenSource); ok {
+		source.transport = c.client
+	}
+
+	return nil
+}
+
+// SetEndpoints sets addresses of oauth and push servers
+func (c *HuaweiClient) SetEndpoints(endpoints Endpoints) error {
+	if err := endpoints.Validate(); err != nil {
+		return err
+	}
+	c.endpoints = endpoints
+
+	// default token source must request tokens from the same site
+	if source, ok := c.tokenSource.(*clientCredentialsTokenSource); ok {
+		source.authURL = endpoints.AuthURL
+	}
+
+	return nil
+}
+
+// SetLogger sets logger of client events. Logger of transport is set separately
+func (c *HuaweiClient) SetLogger(logger Logger) error {
+	if logger == nil {
+		return errors.New("passed empty logger")
+	}
+	c.logger = logger
+
+	return nil
+}
+
+// SetMetrics sets collector of client measurements. Metrics of transport are set separately
+func (c *HuaweiClient) SetMetrics(metrics Metrics) error {
+	if metrics == nil {
+		return errors.New("passed empty metrics")
+	}
+	c.metrics = metrics
+
+	return nil
+}
+
+// SetTracer sets tracer of client operations. Tracer of transport is set separately
+func (c *HuaweiClient) SetTracer(tracer Tracer) error {
+	if tracer == nil {
+		return errors.New("passed empty tracer")
+	}
+	c.tracer = tracer
+
+	return nil
+}
+
+// SetTokenSource replaces default client credentials flow with provided token source
+func (c *HuaweiClient) SetTokenSource(tokenSource TokenSource) error {
+	if tokenSource == nil {
+		return errors.New("passed empty token source")
+	}
+	c.tokenSource = tokenSource
+
+	return nil
+}
+
+// SetTokenStore sets storage which is checked before requesting new token from token source.
+// Tokens are stored under app id key, so all clients of the same app sharing the store reuse one token
+func (c *HuaweiClient) SetTokenStore(store TokenStore) error {
+	if store == nil {
+		return errors.New("passed empty token store")
+	}
+	c.tokenStore = store
+
+	return nil
+}
+
+// SetHMSErrors enables returning non-success response code from SendMessage as *HMSError.
+// Response is returned along with error in that case
+func (c *HuaweiClient) SetHMSErrors(enabled bool) {
+	c.hmsErrors = enabled
+}
+
+// SetInvalidTokenHandler sets handler which is called synchronously from SendMessage
+// when push server reports some or all device tokens of message as invalid
+func (c *HuaweiClient) SetInvalidTokenHandler(handler InvalidTokenHandler) error {
+	if handler == nil {
+		return errors.New("passed empty invalid token handler")
+	}
+	c.invalidTokenHandler = handler
+
+	return nil
+}
+
+// SetBatchConcurrency sets max number of requests sent concurrently by SendBatch
+func (c *HuaweiClient) SetBatchConcurrency(concurrency int) error {
+	if concurrency < 1 {
+		return errors.New("batch concurrency must be positive")
+	}
+	c.batchConcurrency = concurrency
+
+	return nil
+}
+
+// SetPushRateLimiter sets limiter of requests to push server. Retries of default transport
+// are limited and adapt its rate as well as first attempt
+func (c *HuaweiClient) SetPushRateLimiter(limiter *RateLimiter) error {
+	if limiter == nil {
+		return errors.New("passed empty rate limiter")
+	}
+	c.pushLimiter = limiter
+
+	return nil
+}
+
+// SetAuthRateLimiter sets limiter of requests to token source
+func (c *HuaweiClient) SetAuthRateLimiter(limiter *RateLimiter) error {
+	if limiter == nil {
+		return errors.New("passed empty rate limiter")
+	}
+	c.authLimiter = limiter
+
+	return nil
+}
+
+// SetTokenRefreshMargin sets how long before token expiration it should be refreshed.
+// Tokens living shorter than twice the margin are refreshed in the middle of their lifetime
+func (c *HuaweiClient) SetTokenRefreshMargin(margin time.Duration) error {
+	if margin < 0 {
+		return errors.New("token refresh margin can't be negative")
+	}
+
+	c.tokenMu.Lock()
+	c.tokenRefreshMargin = margin
+	c.tokenMu.Unlock()
 
 	return nil
 }
 
 // GetToken return current token value
 func (c *HuaweiClient) GetToken() string {
+	c.tokenMu.RLock()
+	defer c.tokenMu.RUnlock()
+
 	return c.token
 }
 
-func (c *HuaweiClient) requestToken(ctx context.Context) (string, error) {
-	u, err := url.Parse(c.appSecret)
+// GetTokenExpiry return moment when current token expires. Zero time means expiration is unknown
+func (c *HuaweiClient) GetTokenExpiry() time.Time {
+	c.tokenMu.RLock()
+	defer c.tokenMu.RUnlock()
+
+	return c.tokenExpiry
+}
+
+// currentToken returns current token and whether it can be used without refreshing
+func (c *HuaweiClient) currentToken() (string, bool) {
+	c.tokenMu.RLock()
+	defer c.tokenMu.RUnlock()
+
+	return c.token, c.isTokenUsable(c.token, c.tokenIssuedAt, c.tokenExpiry)
+}
+
+// isTokenUsable reports whether token can be used without refreshing.
+// Caller must hold tokenMu
+func (c *HuaweiClient) isTokenUsable(token string, issuedAt, expiry time.Time) bool {
+	if token == "" {
+		return false
+	}
+
+	if expiry.IsZero() {
+		return true
+	}
+
+	// token living shorter than refresh margin is refreshed in the middle of its lifetime,
+	// otherwise it would never be usable
+	margin := c.tokenRefreshMargin
+	if !issuedAt.IsZero() {
+		if half := expiry.Sub(issuedAt) / 2; half < margin {
+			margin = half
+		}
+	}
+
+	return time.Now().Add(margin).Before(expiry)
+}
+
+// fetchToken takes fresh token from token store if it's configured,
+// otherwise or if store has no usable token requests it from token source
+func (c *HuaweiClient) fetchToken(ctx context.Context, stale string) (*Token, error) {
+	if c.tokenStore == nil {
+		return c.requestToken(ctx)
+	}
+
+	if token, err := c.storedToken(ctx, stale); err != nil || token != nil {
+		if token != nil {
+			c.logger.Debug("access token taken from token store", "app_id", c.appId, "expiry", token.Expiry)
+		}
+		return token, err
+	}
+
+	unlock, err := c.tokenStore.Lock(ctx, c.appId)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
-	body := fmt.Sprintf("grant_type=client_credentials&client_secret=%s&client_id=%s", u.String(), c.appId)
+	defer unlock()
 
-	request := NewHTTPRequest().
-		SetMethod(http.MethodPost).
-		SetURL(authUrl).
-		SetStringBody(body).
-		SetHeader("Content-Type", "application/x-www-form-urlencoded")
+	// other process could update token while we were waiting for lock
+	if token, err := c.storedToken(ctx, stale); err != nil || token != nil {
+		return token, err
+	}
 
-	resp, err := c.client.Send(ctx, request)
+	token, err := c.requestToken(ctx)
 	if err != nil {
-		return "", err
+		return nil, err
 	}
 
-	if resp.Status != http.StatusOK {
-		return "", errors.New("fail get token")
+	if err := c.tokenStore.Set(ctx, c.appId, token); err != nil {
+		return nil, err
 	}
 
-	respDecoder := json.NewDecoder(resp.Body)
-	defer resp.Body.Close()
+	return token, nil
+}
 
-	var token TokenMsg
-	if err := respDecoder.Decode(&token); err != nil {
-		return "", err
+// storedToken returns token from token store or nil if stored token is missing, stale or expiring
+func (c *HuaweiClient) storedToken(ctx context.Context, stale string) (*Token, error) {
+	token, err := c.tokenStore.Get(ctx, c.appId)
+	if err != nil || token == nil {
+		return nil, err
 	}
 
-	return token.AccessToken, nil
+	c.tokenMu.RLock()
+	usable := c.isTokenUsable(token.AccessToken, token.IssuedAt, token.Expiry)
+	c.tokenMu.RUnlock()
+
+	if !usable || token.AccessToken == stale {
+		return nil, nil
+	}
+
+	return token, nil
 }
 
-func (c *HuaweiClient) refreshToken(ctx context.Context) error {
-	token, err := c.requestToken(ctx)
+// requestToken requests new token from token source
+func (c *HuaweiClient) requestToken(ctx context.Context) (*Token, error) {
+	var limiter *requestLimiter
+	if c.authLimiter != nil {
+		if err := c.authLimiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+		ctx, limiter = withRequestLimiter(ctx, c.authLimiter)
+	}
+
+	token, err := c.tokenSource.Token(ctx)
+
+	// default transport reports every attempt itself, custom token sources and transports are reported here
+	if limiter != nil && !limiter.wasReported() {
+		var authErr *AuthError
+		if errors.As(err, &authErr) && authErr.StatusCode == http.StatusTooManyRequests {
+			c.authLimiter.ReportThrottled()
+		} else if err == nil {
+			c.authLimiter.ReportSuccess()
+		}
+	}
+
 	if err != nil {
-		return errors.New("refresh token fail")
+		return nil, fmt.Errorf("refresh token fail: %w", err)
 	}
 
-	c.token = token
-	return nil
+	if token == nil || token.AccessToken == "" {
+		return nil, errors.New("token source returned empty token")
+	}
+
+	if token.IssuedAt.IsZero() {
+		issued := *token
+		issued.IssuedAt = time.Now()
+		token = &issued
+	}
+
+	return token, nil
+}
+
+// accessToken returns valid token, refreshing it if needed
+func (c *HuaweiClient) accessToken(ctx context.Context) (string, error) {
+	token, valid := c.currentToken()
+	if valid {
+		return token, nil
+	}
+
+	return c.refreshToken(ctx, token)
+}
+
+// refreshToken replaces stale token with a new one. Only one refresh is in flight at a time,
+// concurrent callers wait for it and reuse its result instead of requesting token again
+func (c *HuaweiClient) refreshToken(ctx context.Context, stale string) (string, error) {
+	select {
+	case c.refreshSem <- struct{}{}:
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+	defer func() { <-c.refreshSem }()
+
+	// token was already refreshed while we were waiting
+	if token, valid := c.currentToken(); valid && token != stale {
+		return token, nil
+	}
+
+	c.logger.Debug("refreshing access token", "app_id", c.appId)
+
+	ctx, span := c.tracer.Start(ctx, "hms.RefreshToken")
+	defer span.End()
+	span.SetAttributes(Attr(AttrAppId, c.appId))
+
+	start := time.Now()
+	token, err := c.fetchToken(ctx, stale)
+	c.metrics.ObserveTokenRefresh(err == nil, time.Since(start))
+	if err != nil {
+		span.RecordError(err)
+		c.logger.Error("access token refresh failed", "app_id", c.appId, "error", err)
+		return "", err
+	}
+	c.logger.Info("access token refreshed", "app_id", c.appId, "expiry", token.Expiry)
+
+	c.tokenMu.Lock()
+	c.token = token.AccessToken
+	c.tokenExpiry = token.Expiry
+	c.tokenIssuedAt = token.IssuedAt
+	c.tokenMu.Unlock()
+
+	return token.AccessToken, nil
 }
 
 func (c *HuaweiClient) executeApiOperation(ctx context.Context, request *HttpRequest) (*HuaweiResponse, error) {
-	resp, err := c.sendHttpRequest(ctx, request)
+	token, err := c.accessToken(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.sendHttpRequest(ctx, request.SetHeader("Authorization", "Bearer "+token))
 	if err != nil {
 		return nil, err
 	}
 
 	// if need to retry for token timeout or other reasons
-	retry, err := c.isNeedRetry(ctx, resp)
+	retry, token, err := c.isNeedRetry(ctx, resp, token)
 	if err != nil {
 		return nil, err
 	}
 
 	if retry {
-		return c.sendHttpRequest(ctx, request)
+		c.logger.Info("access token rejected by push server, sending request again", "app_id", c.appId, "code", resp.Code, "request_id", resp.RequestId)
+		return c.sendHttpRequest(ctx, request.SetHeader("Authorization", "Bearer "+token))
 	}
 	return resp, err
 }
 
 func (c *HuaweiClient) sendHttpRequest(ctx context.Context, request *HttpRequest) (*HuaweiResponse, error) {
+	var limiter *requestLimiter
+	if c.pushLimiter != nil {
+		if err := c.pushLimiter.Wait(ctx); err != nil {
+			return nil, err
+		}
+		ctx, limiter = withRequestLimiter(ctx, c.pushLimiter)
+	}
+
 	resp, err := c.client.Send(ctx, request)
 	if err != nil {
 		return nil, err
 	}
 
+	// default transport reports every attempt itself, custom transports are reported here
+	if limiter != nil && !limiter.wasReported() {
+		limiter.report(resp.Status)
+	}
+
 	respDecoder := json.NewDecoder(resp.Body)
 	defer resp.Body.Close()
 
@@ -153,22 +516,35 @@ func (c *HuaweiClient) sendHttpRequest(ctx context.Context, request *HttpRequest
 }
 
 // if token is timeout or error or other reason, need to refresh token and send again
-func (c *HuaweiClient) isNeedRetry(ctx context.Context, resp *HuaweiResponse) (bool, error) {
+func (c *HuaweiClient) isNeedRetry(ctx context.Context, resp *HuaweiResponse, token string) (bool, string, error) {
 	if !(resp.Code == TokenTimeoutErrorCode || resp.Code == TokenFailedErrorCode) {
-		return false, nil
+		return false, token, nil
 	}
 
-	if err := c.refreshToken(ctx); err != nil {
-		return false, err
+	token, err := c.refreshToken(ctx, token)
+	if err != nil {
+		return false, "", err
 	}
 
-	return true, nil
+	return true, token, nil
 }
 
 // SendMessage sends a message to huawei cloud common
 // One of Token, Topic and Condition fields must be invoked in message
 // If validationOnly is set to true, the message can be verified by not sent to users
 func (c *HuaweiClient) SendMessage(ctx context.Context, msgRequest *HuaweiMessage) (*HuaweiResponse, error) {
+	ctx, span := c.tracer.Start(ctx, "hms.SendMessage")
+	defer span.End()
+	span.SetAttributes(Attr(AttrAppId, c.appId))
+
+	resp, err := c.sendMessage(ctx, span, msgRequest)
+	if err != nil {
+		span.RecordError(err)
+	}
+	return resp, err
+}
+
+func (c *HuaweiClient) sendMessage(ctx context.Context, span Span, msgRequest *HuaweiMessage) (*HuaweiResponse, error) {
 	if err := msgRequest.Validate(); err != nil {
 		return nil, err
 	}
@@ -178,23 +554,58 @@ func (c *HuaweiClient) SendMessage(ctx context.Context, msgRequest *HuaweiMessag
 		return nil, err
 	}
 
-	// initial send call after client init
-	if c.token == "" {
-		if err := c.refreshToken(ctx); err != nil {
-			return nil, err
-		}
-	}
-
 	request := NewHTTPRequest().
 		SetMethod(http.MethodPost).
-		SetURL(fmt.Sprintf(sendMessageURLFmt, c.appId)).
+		SetURL(c.endpoints.sendMessageURL(c.appId)).
 		SetByteBody(body).
-		SetHeader("Content-Type", "application/json;charset=utf-8").
-		SetHeader("Authorization", "Bearer "+c.token)
+		SetHeader("Content-Type", "application/json;charset=utf-8")
 
+	span.SetAttributes(
+		Attr(AttrTargetType, messageTargetType(msgRequest.Message)),
+		Attr(AttrTokenCount, len(msgRequest.Message.Token)),
+	)
+
+	ctx, retries := withRetryCounter(ctx)
+	start := time.Now()
 	resp, err := c.executeApiOperation(ctx, request)
+	span.SetAttributes(Attr(AttrRetryCount, int(atomic.LoadInt32(retries))))
 	if err != nil {
+		c.metrics.ObserveSend("", time.Since(start))
+		c.logger.Error("message sending failed", "app_id", c.appId, "error", err)
 		return resp, err
 	}
-	return resp, err
+	c.metrics.ObserveSend(resp.Code, time.Since(start))
+	span.SetAttributes(Attr(AttrResponseCode, string(resp.Code)), Attr(AttrRequestId, resp.RequestId))
+
+	if resp.Code == SuccessCode {
+		c.logger.Debug("message sent", "app_id", c.appId, "code", resp.Code, "request_id", resp.RequestId)
+	} else {
+		c.logger.Warn("push server rejected message", "app_id", c.appId, "code", resp.Code, "msg", resp.Msg, "request_id", resp.RequestId)
+	}
+
+	c.reportInvalidTokens(ctx, msgRequest, resp)
+
+	if c.hmsErrors {
+		return resp, resp.Err()
+	}
+	return resp, nil
+}
+
+// reportInvalidTokens passes tokens rejected by push server to invalid token handler
+func (c *HuaweiClient) reportInvalidTokens(ctx context.Context, msgRequest *HuaweiMessage, resp *HuaweiResponse) {
+	if c.invalidTokenHandler == nil {
+		return
+	}
+
+	var tokens []string
+	switch {
+	case resp.Code == AllTokenInvalidErrorCode:
+		tokens = append(tokens, msgRequest.Message.Token...)
+	case resp.Partial != nil:
+		tokens = resp.Partial.IllegalTokens
+	}
+
+	if len(tokens) > 0 {
+		c.invalidTokenHandler(ctx, tokens)
+	}
 }
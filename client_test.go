@@ -0,0 +1,78 @@
+package hms
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// shortLivedTokenSource issues tokens living shorter than default refresh margin
+type shortLivedTokenSource struct {
+	ttl   time.Duration
+	calls int32
+}
+
+func (s *shortLivedTokenSource) Token(ctx context.Context) (*Token, error) {
+	atomic.AddInt32(&s.calls, 1)
+	return &Token{AccessToken: "short", Expiry: time.Now().Add(s.ttl)}, nil
+}
+
+func TestClientReusesTokenShorterThanRefreshMargin(t *testing.T) {
+	source := &shortLivedTokenSource{ttl: time.Minute}
+
+	var (
+		mu             sync.Mutex
+		authorizations []string
+	)
+	client, err := NewHuaweiClient("app", "secret",
+		WithTransport(successTransport(&authorizations, &mu)),
+		WithTokenSource(source),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := client.SendMessage(context.Background(), GetDefaultAndroidNotificationMessage([]string{"device"})); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if calls := atomic.LoadInt32(&source.calls); calls != 1 {
+		t.Fatalf("token source was called %d times, want 1", calls)
+	}
+}
+
+func TestIsTokenUsable(t *testing.T) {
+	client, err := NewHuaweiClient("app", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	tests := []struct {
+		name     string
+		issuedAt time.Time
+		expiry   time.Time
+		want     bool
+	}{
+		{"unknown expiry", time.Time{}, time.Time{}, true},
+		{"long lived", now, now.Add(time.Hour), true},
+		{"long lived in margin", now.Add(-56 * time.Minute), now.Add(4 * time.Minute), false},
+		{"short lived", now, now.Add(time.Minute), true},
+		{"short lived past half", now.Add(-40 * time.Second), now.Add(20 * time.Second), false},
+		{"unknown issue time in margin", time.Time{}, now.Add(time.Minute), false},
+	}
+
+	for _, tt := range tests {
+		if got := client.isTokenUsable("token", tt.issuedAt, tt.expiry); got != tt.want {
+			t.Errorf("%s: isTokenUsable = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	if client.isTokenUsable("", now, now.Add(time.Hour)) {
+		t.Error("empty token is usable")
+	}
+}
@@ -1,11 +1,24 @@
 package hms
 
+import "time"
+
 const (
 	// auth url
-	authUrl = "https://oauth-login.cloud.huawei.com/oauth2/v3/token"
+	authPath = "/oauth2/v3/token"
+	authUrl  = "https://oauth-login.cloud.huawei.com" + authPath
 
 	// push server url
-	sendMessageURLFmt = "https://api.push.hicloud.com/v1/%s/messages:send"
+	pushBaseUrl        = "https://api.push.hicloud.com"
+	sendMessagePathFmt = "/v1/%s/messages:send"
 
 	MaxMessageTTLSec = 15 * 24 * 60 * 60 // 15 days in seconds
+
+	// MaxTokensPerRequest is max number of tokens push server accepts in single message
+	MaxTokensPerRequest = 1000
+
+	// DefaultBatchConcurrency is default number of requests sent concurrently by SendBatch
+	DefaultBatchConcurrency = 4
+
+	// DefaultTokenRefreshMargin is how long before expiration access token is refreshed
+	DefaultTokenRefreshMargin = 5 * time.Minute
 )
@@ -0,0 +1,173 @@
+package hms
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// ErrDispatcherClosed is returned when message is submitted to dispatcher after shutdown
+var ErrDispatcherClosed = errors.New("dispatcher is closed")
+
+// DispatchResult represents result of sending message submitted to dispatcher
+type DispatchResult struct {
+	// Submitted message.
+	Message *HuaweiMessage
+
+	// Push server response, nil if message wasn't sent.
+	Response *HuaweiResponse
+
+	// Error of sending message.
+	Err error
+}
+
+// DispatchResultHandler is called by dispatcher workers with result of every submitted message
+type DispatchResultHandler func(result *DispatchResult)
+
+// Dispatcher sends messages asynchronously. Submitted messages are put to bounded queue
+// and sent by pool of workers using HuaweiClient.SendMessage
+type Dispatcher struct {
+	client  *HuaweiClient
+	queue   chan *HuaweiMessage
+	handler DispatchResultHandler
+	results chan *DispatchResult
+
+	// context of sending, cancelled when shutdown doesn't complete in time
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// mu guards queue from being closed while message is submitted
+	mu        sync.RWMutex
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// closed when all workers exited
+	stopped chan struct{}
+}
+
+// NewDispatcher creates dispatcher and starts its workers.
+// Results are passed to handler if it's set, otherwise they are sent to Results channel which must be read
+func NewDispatcher(client *HuaweiClient, workers, queueSize int, handler DispatchResultHandler) (*Dispatcher, error) {
+	if client == nil {
+		return nil, errors.New("passed empty client")
+	}
+
+	if workers < 1 {
+		return nil, errors.New("number of workers must be positive")
+	}
+
+	if queueSize < 0 {
+		return nil, errors.New("queue size can't be negative")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &Dispatcher{
+		client:  client,
+		queue:   make(chan *HuaweiMessage, queueSize),
+		handler: handler,
+		ctx:     ctx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+
+	if handler == nil {
+		d.results = make(chan *DispatchResult, queueSize)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.work()
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		if d.results != nil {
+			close(d.results)
+		}
+		close(d.stopped)
+	}()
+
+	return d, nil
+}
+
+// Results returns channel of results. It's nil if dispatcher was created with result handler,
+// otherwise it's closed after shutdown when all results are sent
+func (d *Dispatcher) Results() <-chan *DispatchResult {
+	return d.results
+}
+
+// Submit puts message to queue. If queue is full it waits until there is free space,
+// context is done or dispatcher is shut down
+func (d *Dispatcher) Submit(ctx context.Context, msg *HuaweiMessage) error {
+	if msg == nil {
+		return errors.New("passed empty message")
+	}
+
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+
+	select {
+	case <-d.done:
+		return ErrDispatcherClosed
+	default:
+	}
+
+	select {
+	case d.queue <- msg:
+		return nil
+	case <-d.done:
+		return ErrDispatcherClosed
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown stops accepting messages and waits until queued messages are sent.
+// If context is done before that, sending is cancelled and context error is returned
+// without waiting for workers. Messages left in queue are reported with context.Canceled error,
+// results which aren't read from Results channel after cancellation are dropped
+func (d *Dispatcher) Shutdown(ctx context.Context) error {
+	d.closeOnce.Do(func() {
+		// unblock submitters waiting for free space before acquiring lock
+		close(d.done)
+
+		d.mu.Lock()
+		close(d.queue)
+		d.mu.Unlock()
+	})
+
+	select {
+	case <-d.stopped:
+		d.cancel()
+		return nil
+	case <-ctx.Done():
+		d.cancel()
+		return ctx.Err()
+	}
+}
+
+func (d *Dispatcher) work() {
+	for msg := range d.queue {
+		result := &DispatchResult{Message: msg}
+		if err := d.ctx.Err(); err != nil {
+			result.Err = err
+		} else {
+			result.Response, result.Err = d.client.SendMessage(d.ctx, msg)
+		}
+
+		if d.handler != nil {
+			d.handler(result)
+		} else {
+			// nobody may read results after sending was cancelled
+			select {
+			case d.results <- result:
+			case <-d.ctx.Done():
+			}
+		}
+	}
+}
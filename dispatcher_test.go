@@ -0,0 +1,61 @@
+package hms_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	hms "github.com/icecream78/go-hms-push"
+	"github.com/icecream78/go-hms-push/hmstest"
+)
+
+func TestDispatcherShutdownWithUnreadResults(t *testing.T) {
+	server := hmstest.NewServer("app", "secret")
+	defer server.Close()
+
+	client, err := hms.NewHuaweiClient("app", "secret", hms.WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dispatcher, err := hms.NewDispatcher(client, 1, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if err := dispatcher.Submit(context.Background(), hms.GetDefaultAndroidNotificationMessage([]string{"token"})); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- dispatcher.Shutdown(ctx)
+	}()
+
+	select {
+	case err := <-done:
+		if err != context.DeadlineExceeded {
+			t.Fatalf("shutdown error = %v, want %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("shutdown doesn't honour its context")
+	}
+
+	// workers exit after cancellation and close results
+	timeout := time.After(2 * time.Second)
+	for {
+		select {
+		case _, ok := <-dispatcher.Results():
+			if !ok {
+				return
+			}
+		case <-timeout:
+			t.Fatal("results channel isn't closed after shutdown")
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package hms
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Endpoints represents addresses of huawei oauth and push servers
+type Endpoints struct {
+	// URL of oauth server token endpoint.
+	AuthURL string
+
+	// Base URL of push server, path of push api is appended to it.
+	PushBaseURL string
+}
+
+var (
+	// DefaultEndpoints are global huawei servers
+	DefaultEndpoints = Endpoints{
+		AuthURL:     authUrl,
+		PushBaseURL: pushBaseUrl,
+	}
+
+	// EuropeEndpoints are servers of Europe data storage location
+	EuropeEndpoints = Endpoints{
+		AuthURL:     authUrl,
+		PushBaseURL: "https://push-api.cloud.huawei.eu",
+	}
+
+	// RussiaEndpoints are servers of Russia data storage location
+	RussiaEndpoints = Endpoints{
+		AuthURL:     "https://oauth-login.cloud.huawei.ru" + authPath,
+		PushBaseURL: "https://push-api.cloud.huawei.ru",
+	}
+
+	// SingaporeEndpoints are servers of Singapore data storage location
+	SingaporeEndpoints = Endpoints{
+		AuthURL:     authUrl,
+		PushBaseURL: "https://push-api.cloud.huawei.asia",
+	}
+)
+
+// NewEndpoints returns endpoints of single server serving both oauth and push api,
+// for example local stand-in used in integration tests
+func NewEndpoints(baseURL string) Endpoints {
+	baseURL = strings.TrimRight(baseURL, "/")
+
+	return Endpoints{
+		AuthURL:     baseURL + authPath,
+		PushBaseURL: baseURL,
+	}
+}
+
+// Validate checks that both endpoints are absolute URLs
+func (e Endpoints) Validate() error {
+	for _, endpoint := range []string{e.AuthURL, e.PushBaseURL} {
+		u, err := url.Parse(endpoint)
+		if err != nil {
+			return err
+		}
+
+		if u.Scheme == "" || u.Host == "" {
+			return errors.New("endpoint must be absolute url")
+		}
+	}
+	return nil
+}
+
+// sendMessageURL returns push api URL of app
+func (e Endpoints) sendMessageURL(appId string) string {
+	return strings.TrimRight(e.PushBaseURL, "/") + fmt.Sprintf(sendMessagePathFmt, appId)
+}
@@ -0,0 +1,251 @@
+// Package hmstest provides in-process fake of huawei oauth and push servers for testing HuaweiClient.
+// Point client to fake server with hms.WithBaseURL(server.URL)
+package hmstest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"time"
+
+	hms "github.com/icecream78/go-hms-push"
+)
+
+const (
+	authPath          = "/oauth2/v3/token"
+	sendMessagePrefix = "/v1/"
+	sendMessageSuffix = "/messages:send"
+
+	// DefaultTokenTTL is lifetime of access tokens issued by fake server
+	DefaultTokenTTL = time.Hour
+)
+
+// Response is scripted response of push endpoint
+type Response struct {
+	// HTTP status, 200 is used if it's zero.
+	Status int
+
+	// Result code.
+	Code hms.ResponseCode
+
+	// Result code description.
+	Msg string
+}
+
+// PartialSuccess builds response with SomeTokenSuccessErrorCode and result description listing illegal tokens
+func PartialSuccess(successCount int, illegalTokens ...string) Response {
+	msg, _ := json.Marshal(hms.PartialResult{
+		SuccessCount:  successCount,
+		FailureCount:  len(illegalTokens),
+		IllegalTokens: illegalTokens,
+	})
+
+	return Response{Code: hms.SomeTokenSuccessErrorCode, Msg: string(msg)}
+}
+
+// Server emulates oauth token endpoint and message sending endpoint of single app.
+// Push requests without valid access token are rejected with TokenFailedErrorCode,
+// requests with expired token with TokenTimeoutErrorCode. Valid requests are answered
+// with scripted responses in order and with success when script is over
+type Server struct {
+	*httptest.Server
+
+	appId     string
+	appSecret string
+
+	mu            sync.Mutex
+	tokenTTL      time.Duration
+	tokens        map[string]time.Time
+	tokenRequests int
+	script        []Response
+	messages      []*hms.HuaweiMessage
+	requestId     int
+}
+
+// NewServer starts fake server accepting credentials of single app. Server must be closed with Close
+func NewServer(appId, appSecret string) *Server {
+	s := &Server{
+		appId:     appId,
+		appSecret: appSecret,
+		tokenTTL:  DefaultTokenTTL,
+		tokens:    make(map[string]time.Time),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(authPath, s.handleToken)
+	mux.HandleFunc(sendMessagePrefix, s.handleSend)
+	s.Server = httptest.NewServer(mux)
+
+	return s
+}
+
+// SetTokenTTL sets lifetime of access tokens issued after this call
+func (s *Server) SetTokenTTL(ttl time.Duration) {
+	s.mu.Lock()
+	s.tokenTTL = ttl
+	s.mu.Unlock()
+}
+
+// Enqueue appends responses to script of push endpoint
+func (s *Server) Enqueue(responses ...Response) {
+	s.mu.Lock()
+	s.script = append(s.script, responses...)
+	s.mu.Unlock()
+}
+
+// EnqueueCode appends responses with provided result codes to script of push endpoint
+func (s *Server) EnqueueCode(codes ...hms.ResponseCode) {
+	responses := make([]Response, 0, len(codes))
+	for _, code := range codes {
+		responses = append(responses, Response{Code: code, Msg: string(code)})
+	}
+	s.Enqueue(responses...)
+}
+
+// ExpireTokens makes all issued access tokens expired
+func (s *Server) ExpireTokens() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for token := range s.tokens {
+		s.tokens[token] = time.Time{}
+	}
+}
+
+// TokenRequests returns number of access tokens issued by server
+func (s *Server) TokenRequests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.tokenRequests
+}
+
+// Messages returns messages of all authorized push requests in order they were received.
+// Message resent after token refresh is returned twice
+func (s *Server) Messages() []*hms.HuaweiMessage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]*hms.HuaweiMessage(nil), s.messages...)
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		writeTokenError(w, "invalid_request", "fail parse form")
+		return
+	}
+
+	if r.PostForm.Get("grant_type") != "client_credentials" {
+		writeTokenError(w, "unsupported_grant_type", "only client_credentials grant type is supported")
+		return
+	}
+
+	if r.PostForm.Get("client_id") != s.appId || r.PostForm.Get("client_secret") != s.appSecret {
+		writeTokenError(w, "invalid_client", "unknown client id or wrong client secret")
+		return
+	}
+
+	s.mu.Lock()
+	s.tokenRequests++
+	token := fmt.Sprintf("hmstest-token-%d", s.tokenRequests)
+	ttl := s.tokenTTL
+	s.tokens[token] = time.Now().Add(ttl)
+	s.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, hms.TokenMsg{
+		AccessToken: token,
+		ExpiresIn:   int(ttl / time.Second),
+	})
+}
+
+func (s *Server) handleSend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || !strings.HasSuffix(r.URL.Path, sendMessageSuffix) {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+
+	if appId := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, sendMessagePrefix), sendMessageSuffix); appId != s.appId {
+		s.writeResponse(w, Response{Status: http.StatusForbidden, Code: hms.NoPushPermissionErrorCode, Msg: "unknown app id"})
+		return
+	}
+
+	if resp, ok := s.authorize(r.Header.Get("Authorization")); !ok {
+		s.writeResponse(w, resp)
+		return
+	}
+
+	var msg hms.HuaweiMessage
+	if err := json.NewDecoder(r.Body).Decode(&msg); err != nil {
+		s.writeResponse(w, Response{Status: http.StatusBadRequest, Code: hms.IncorrectMessageErrorCode, Msg: "fail parse message"})
+		return
+	}
+
+	s.mu.Lock()
+	s.messages = append(s.messages, &msg)
+	resp := Response{Code: hms.SuccessCode, Msg: "Success"}
+	if len(s.script) > 0 {
+		resp = s.script[0]
+		s.script = s.script[1:]
+	}
+	s.mu.Unlock()
+
+	s.writeResponse(w, resp)
+}
+
+// authorize checks bearer token and returns response for rejected request
+func (s *Server) authorize(header string) (Response, bool) {
+	token := strings.TrimPrefix(header, "Bearer ")
+
+	s.mu.Lock()
+	expiry, ok := s.tokens[token]
+	s.mu.Unlock()
+
+	if !ok || header == token {
+		return Response{Status: http.StatusUnauthorized, Code: hms.TokenFailedErrorCode, Msg: "invalid access token"}, false
+	}
+
+	if !time.Now().Before(expiry) {
+		return Response{Status: http.StatusUnauthorized, Code: hms.TokenTimeoutErrorCode, Msg: "access token expired"}, false
+	}
+
+	return Response{}, true
+}
+
+func (s *Server) writeResponse(w http.ResponseWriter, resp Response) {
+	s.mu.Lock()
+	s.requestId++
+	requestId := fmt.Sprintf("hmstest-request-%d", s.requestId)
+	s.mu.Unlock()
+
+	status := resp.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+
+	writeJSON(w, status, hms.HuaweiResponse{
+		Code:      resp.Code,
+		Msg:       resp.Msg,
+		RequestId: requestId,
+	})
+}
+
+func writeTokenError(w http.ResponseWriter, code, description string) {
+	writeJSON(w, http.StatusBadRequest, hms.TokenMsg{
+		Error:            code,
+		ErrorDescription: description,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json;charset=utf-8")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
@@ -0,0 +1,338 @@
+package hmstest_test
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	hms "github.com/icecream78/go-hms-push"
+	"github.com/icecream78/go-hms-push/hmstest"
+)
+
+type invalidTokens struct {
+	mu     sync.Mutex
+	tokens []string
+}
+
+func (i *invalidTokens) handle(ctx context.Context, tokens []string) {
+	i.mu.Lock()
+	i.tokens = append(i.tokens, tokens...)
+	i.mu.Unlock()
+}
+
+func (i *invalidTokens) get() []string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return append([]string(nil), i.tokens...)
+}
+
+func newClient(t *testing.T, server *hmstest.Server, opts ...hms.Option) *hms.HuaweiClient {
+	t.Helper()
+
+	client, err := hms.NewHuaweiClient("app", "secret", append([]hms.Option{hms.WithBaseURL(server.URL)}, opts...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func send(t *testing.T, client *hms.HuaweiClient, tokens ...string) *hms.HuaweiResponse {
+	t.Helper()
+
+	resp, err := client.SendMessage(context.Background(), hms.GetDefaultAndroidNotificationMessage(tokens))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestClientAgainstFakeServer(t *testing.T) {
+	server := hmstest.NewServer("app", "secret")
+	defer server.Close()
+
+	invalid := &invalidTokens{}
+	client := newClient(t, server, hms.WithInvalidTokenHandler(invalid.handle))
+
+	// token is issued once and reused
+	for i := 0; i < 2; i++ {
+		if resp := send(t, client, "device"); resp.Code != hms.SuccessCode {
+			t.Fatalf("code = %s, want %s", resp.Code, hms.SuccessCode)
+		}
+	}
+	if n := server.TokenRequests(); n != 1 {
+		t.Fatalf("server issued %d tokens, want 1", n)
+	}
+
+	// expired token is rejected with TokenTimeoutErrorCode, client refreshes it and resends message
+	server.ExpireTokens()
+	if resp := send(t, client, "device"); resp.Code != hms.SuccessCode {
+		t.Fatalf("code after token expiration = %s, want %s", resp.Code, hms.SuccessCode)
+	}
+	if n := server.TokenRequests(); n != 2 {
+		t.Fatalf("server issued %d tokens, want 2", n)
+	}
+
+	// partial success is parsed and illegal tokens are reported
+	server.Enqueue(hmstest.PartialSuccess(1, "illegal"))
+	resp := send(t, client, "device", "illegal")
+	if resp.Code != hms.SomeTokenSuccessErrorCode {
+		t.Fatalf("code = %s, want %s", resp.Code, hms.SomeTokenSuccessErrorCode)
+	}
+	want := &hms.PartialResult{SuccessCount: 1, FailureCount: 1, IllegalTokens: []string{"illegal"}}
+	if !reflect.DeepEqual(resp.Partial, want) {
+		t.Fatalf("partial result = %+v, want %+v", resp.Partial, want)
+	}
+
+	// all tokens invalid
+	server.EnqueueCode(hms.AllTokenInvalidErrorCode)
+	if resp := send(t, client, "stale"); resp.Code != hms.AllTokenInvalidErrorCode {
+		t.Fatalf("code = %s, want %s", resp.Code, hms.AllTokenInvalidErrorCode)
+	}
+	if tokens := invalid.get(); !reflect.DeepEqual(tokens, []string{"illegal", "stale"}) {
+		t.Fatalf("invalid tokens = %v, want [illegal stale]", tokens)
+	}
+
+	// message rejected with expired token isn't recorded
+	messages := server.Messages()
+	if len(messages) != 5 {
+		t.Fatalf("server received %d messages, want 5", len(messages))
+	}
+	if tokens := messages[3].Message.Token; !reflect.DeepEqual(tokens, []string{"device", "illegal"}) {
+		t.Fatalf("message tokens = %v, want [device illegal]", tokens)
+	}
+}
+
+func TestClientRefreshesTokenOnScriptedTimeout(t *testing.T) {
+	server := hmstest.NewServer("app", "secret")
+	defer server.Close()
+
+	client := newClient(t, server)
+	server.EnqueueCode(hms.TokenTimeoutErrorCode)
+
+	if resp := send(t, client, "device"); resp.Code != hms.SuccessCode {
+		t.Fatalf("code = %s, want %s", resp.Code, hms.SuccessCode)
+	}
+	if n := server.TokenRequests(); n != 2 {
+		t.Fatalf("server issued %d tokens, want 2", n)
+	}
+	if n := len(server.Messages()); n != 2 {
+		t.Fatalf("server received %d messages, want 2", n)
+	}
+}
+
+func TestClientReusesShortLivedToken(t *testing.T) {
+	server := hmstest.NewServer("app", "secret")
+	defer server.Close()
+	server.SetTokenTTL(time.Minute)
+
+	client := newClient(t, server)
+	for i := 0; i < 3; i++ {
+		send(t, client, "device")
+	}
+
+	if n := server.TokenRequests(); n != 1 {
+		t.Fatalf("server issued %d tokens, want 1", n)
+	}
+}
+
+func TestConcurrentSendsShareTokenRefresh(t *testing.T) {
+	server := hmstest.NewServer("app", "secret")
+	defer server.Close()
+
+	client := newClient(t, server)
+	send(t, client, "device")
+	server.ExpireTokens()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.SendMessage(context.Background(), hms.GetDefaultAndroidNotificationMessage([]string{"device"})); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := server.TokenRequests(); n != 2 {
+		t.Fatalf("server issued %d tokens, want 2", n)
+	}
+}
+
+func TestFakeServerRejectsWrongCredentials(t *testing.T) {
+	server := hmstest.NewServer("app", "secret")
+	defer server.Close()
+
+	client, err := hms.NewHuaweiClient("app", "wrong", hms.WithBaseURL(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.SendMessage(context.Background(), hms.GetDefaultAndroidNotificationMessage([]string{"device"}))
+	var authErr *hms.AuthError
+	if !errors.As(err, &authErr) {
+		t.Fatalf("error = %v, want auth error", err)
+	}
+	if authErr.StatusCode != http.StatusBadRequest || authErr.Code != "invalid_client" || !authErr.Permanent {
+		t.Fatalf("auth error = %+v, want permanent invalid_client with status 400", authErr)
+	}
+	if n := len(server.Messages()); n != 0 {
+		t.Fatalf("server received %d messages, want 0", n)
+	}
+}
+
+func TestFakeServerRecordsMessageWithDurations(t *testing.T) {
+	server := hmstest.NewServer("app", "secret")
+	defer server.Close()
+
+	client := newClient(t, server)
+
+	msg := hms.GetDefaultAndroidNotificationMessage([]string{"device"})
+	msg.Message.Android.TTL = hms.NewTTL(time.Hour)
+	msg.Message.Android.Notification.VibrateConfig = []*hms.TTL{hms.NewTTL(time.Second), hms.NewTTL(1500 * time.Millisecond)}
+
+	resp, err := client.SendMessage(context.Background(), msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Code != hms.SuccessCode {
+		t.Fatalf("code = %s, want %s", resp.Code, hms.SuccessCode)
+	}
+
+	messages := server.Messages()
+	if len(messages) != 1 {
+		t.Fatalf("server received %d messages, want 1", len(messages))
+	}
+
+	android := messages[0].Message.Android
+	if ttl := android.TTL.Seconds(); ttl != time.Hour.Seconds() {
+		t.Fatalf("ttl = %vs, want %vs", ttl, time.Hour.Seconds())
+	}
+	if vibrate := android.Notification.VibrateConfig; len(vibrate) != 2 || vibrate[1].Seconds() != 1.5 {
+		t.Fatalf("vibrate config = %v, want [1s 1.5s]", vibrate)
+	}
+}
+
+func TestClientReturnsHMSErrors(t *testing.T) {
+	server := hmstest.NewServer("app", "secret")
+	defer server.Close()
+
+	client := newClient(t, server, hms.WithHMSErrors())
+
+	server.Enqueue(hmstest.Response{Code: hms.ParameterErrorCode, Msg: "bad parameter"})
+	resp, err := client.SendMessage(context.Background(), hms.GetDefaultAndroidNotificationMessage([]string{"device"}))
+	if resp == nil || resp.Code != hms.ParameterErrorCode {
+		t.Fatalf("response = %+v, want response with code %s", resp, hms.ParameterErrorCode)
+	}
+
+	var hmsErr *hms.HMSError
+	if !errors.As(err, &hmsErr) {
+		t.Fatalf("error = %v, want push server error", err)
+	}
+	if hmsErr.Code != hms.ParameterErrorCode || hmsErr.Msg != "bad parameter" || hmsErr.RequestId != resp.RequestId || hmsErr.RequestId == "" {
+		t.Fatalf("push server error = %+v, want error matching response %+v", hmsErr, resp)
+	}
+
+	resp, err = client.SendMessage(context.Background(), hms.GetDefaultAndroidNotificationMessage([]string{"device"}))
+	if err != nil {
+		t.Fatalf("error = %v, want nil for success", err)
+	}
+	if resp.Code != hms.SuccessCode {
+		t.Fatalf("code = %s, want %s", resp.Code, hms.SuccessCode)
+	}
+}
+
+// recordingTracer keeps all started spans
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordingSpan
+}
+
+func (r *recordingTracer) Start(ctx context.Context, spanName string) (context.Context, hms.Span) {
+	span := &recordingSpan{name: spanName, attrs: make(map[string]interface{})}
+
+	r.mu.Lock()
+	r.spans = append(r.spans, span)
+	r.mu.Unlock()
+
+	return ctx, span
+}
+
+// byName returns ended spans with provided name
+func (r *recordingTracer) byName(name string) []*recordingSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var spans []*recordingSpan
+	for _, span := range r.spans {
+		if span.name == name && span.ended {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+type recordingSpan struct {
+	name  string
+	attrs map[string]interface{}
+	ended bool
+}
+
+func (s *recordingSpan) SetAttributes(attrs ...hms.Attribute) {
+	for _, attr := range attrs {
+		s.attrs[attr.Key] = attr.Value
+	}
+}
+
+func (s *recordingSpan) RecordError(err error) {}
+func (s *recordingSpan) End()                  { s.ended = true }
+
+func TestClientTracesSendWithRetry(t *testing.T) {
+	server := hmstest.NewServer("app", "secret")
+	defer server.Close()
+
+	tracer := &recordingTracer{}
+	client := newClient(t, server, hms.WithTracer(tracer), hms.WithRetryPolicy(3, hms.NewConstantBackoff(0)))
+
+	server.Enqueue(hmstest.Response{Status: http.StatusInternalServerError, Code: hms.InternalErrorCode})
+	resp := send(t, client, "first", "second")
+	if resp.Code != hms.SuccessCode {
+		t.Fatalf("code = %s, want %s", resp.Code, hms.SuccessCode)
+	}
+
+	sends := tracer.byName("hms.SendMessage")
+	if len(sends) != 1 {
+		t.Fatalf("%d send spans, want 1", len(sends))
+	}
+	want := map[string]interface{}{
+		hms.AttrAppId:        "app",
+		hms.AttrTargetType:   "token",
+		hms.AttrTokenCount:   2,
+		hms.AttrResponseCode: string(hms.SuccessCode),
+		hms.AttrRequestId:    resp.RequestId,
+		hms.AttrRetryCount:   1,
+	}
+	if !reflect.DeepEqual(sends[0].attrs, want) {
+		t.Fatalf("send span attributes = %v, want %v", sends[0].attrs, want)
+	}
+
+	refreshes := tracer.byName("hms.RefreshToken")
+	if len(refreshes) != 1 || refreshes[0].attrs[hms.AttrAppId] != "app" {
+		t.Fatalf("refresh spans = %+v, want one span with app id", refreshes)
+	}
+
+	// token request and two attempts of push request
+	var statuses []interface{}
+	for _, span := range tracer.byName("hms.HTTPAttempt") {
+		statuses = append(statuses, span.attrs[hms.AttrHTTPStatus])
+	}
+	if want := []interface{}{http.StatusOK, http.StatusInternalServerError, http.StatusOK}; !reflect.DeepEqual(statuses, want) {
+		t.Fatalf("attempt span statuses = %v, want %v", statuses, want)
+	}
+}
@@ -0,0 +1,93 @@
+package hms
+
+import (
+	"context"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveHeaders carry credentials and are redacted in logs and recorded interactions
+var sensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// Logger receives leveled structured events of client and transport.
+// Args are alternating keys and values. *slog.Logger satisfies this interface
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Warn(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// nopLogger discards all events, it's used when logger isn't set
+type nopLogger struct{}
+
+func (nopLogger) Debug(msg string, args ...interface{}) {}
+func (nopLogger) Info(msg string, args ...interface{})  {}
+func (nopLogger) Warn(msg string, args ...interface{})  {}
+func (nopLogger) Error(msg string, args ...interface{}) {}
+
+// LoggingMiddleware logs every request and response at debug level.
+// Credential headers and client secret are redacted
+func LoggingMiddleware(logger Logger) Middleware {
+	return func(next Transporter) Transporter {
+		return TransporterFunc(func(ctx context.Context, req *HttpRequest) (*HttpResponse, error) {
+			logger.Debug("sending http request",
+				"method", req.Method,
+				"url", req.URL,
+				"headers", redactHeaders(req.Headers),
+				"body", redactBody(req),
+			)
+
+			start := time.Now()
+			resp, err := next.Send(ctx, req)
+			if err != nil {
+				logger.Debug("http request failed", "method", req.Method, "url", req.URL, "error", err, "duration", time.Since(start))
+				return resp, err
+			}
+
+			logger.Debug("received http response", "method", req.Method, "url", req.URL, "status", resp.Status, "duration", time.Since(start))
+			return resp, nil
+		})
+	}
+}
+
+// redactHeaders returns copy of headers with credentials replaced
+func redactHeaders(headers map[string]string) map[string]string {
+	result := make(map[string]string, len(headers))
+	for header, value := range headers {
+		if isSensitiveHeader(header) {
+			value = redacted
+		}
+		result[header] = value
+	}
+	return result
+}
+
+func isSensitiveHeader(header string) bool {
+	for _, sensitive := range sensitiveHeaders {
+		if strings.EqualFold(header, sensitive) {
+			return true
+		}
+	}
+	return false
+}
+
+// redactBody returns request body with client secret of token request replaced
+func redactBody(req *HttpRequest) string {
+	if !strings.HasPrefix(req.Headers["Content-Type"], "application/x-www-form-urlencoded") {
+		return string(req.Body)
+	}
+
+	form, err := url.ParseQuery(string(req.Body))
+	if err != nil {
+		return redacted
+	}
+
+	if form.Get("client_secret") != "" {
+		form.Set("client_secret", redacted)
+	}
+	return form.Encode()
+}
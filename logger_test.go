@@ -0,0 +1,96 @@
+package hms
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// capturingLogger keeps logged events
+type capturingLogger struct {
+	mu     sync.Mutex
+	events []capturedEvent
+}
+
+type capturedEvent struct {
+	level string
+	msg   string
+	args  map[string]interface{}
+}
+
+func (l *capturingLogger) log(level, msg string, args []interface{}) {
+	event := capturedEvent{level: level, msg: msg, args: make(map[string]interface{})}
+	for i := 0; i+1 < len(args); i += 2 {
+		event.args[fmt.Sprint(args[i])] = args[i+1]
+	}
+
+	l.mu.Lock()
+	l.events = append(l.events, event)
+	l.mu.Unlock()
+}
+
+func (l *capturingLogger) Debug(msg string, args ...interface{}) { l.log("debug", msg, args) }
+func (l *capturingLogger) Info(msg string, args ...interface{})  { l.log("info", msg, args) }
+func (l *capturingLogger) Warn(msg string, args ...interface{})  { l.log("warn", msg, args) }
+func (l *capturingLogger) Error(msg string, args ...interface{}) { l.log("error", msg, args) }
+
+func TestLoggingMiddlewareRedactsCredentials(t *testing.T) {
+	logger := &capturingLogger{}
+	transport := Chain(okTransport, LoggingMiddleware(logger))
+
+	tokenReq := NewHTTPRequest().
+		SetMethod(http.MethodPost).
+		SetURL("https://oauth-login.cloud.huawei.com/oauth2/v3/token").
+		SetHeader("Content-Type", "application/x-www-form-urlencoded").
+		SetStringBody("grant_type=client_credentials&client_id=app&client_secret=top-secret")
+	pushReq := NewHTTPRequest().
+		SetMethod(http.MethodPost).
+		SetURL("https://push-api.cloud.huawei.com/v1/app/messages:send").
+		SetHeader("Authorization", "Bearer top-secret").
+		SetHeader("proxy-authorization", "Basic top-secret").
+		SetHeader("Content-Type", "application/json;charset=utf-8").
+		SetStringBody(`{"message":{"token":["device"]}}`)
+
+	for _, req := range []*HttpRequest{tokenReq, pushReq} {
+		if _, err := transport.Send(context.Background(), req); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var sent []capturedEvent
+	for _, event := range logger.events {
+		if strings.Contains(fmt.Sprint(event.args), "top-secret") {
+			t.Fatalf("credentials leaked to %q event: %v", event.msg, event.args)
+		}
+		if event.msg == "sending http request" {
+			sent = append(sent, event)
+		}
+	}
+	if len(sent) != 2 {
+		t.Fatalf("logged %d sent requests, want 2", len(sent))
+	}
+
+	form := sent[0].args["body"].(string)
+	if !strings.Contains(form, "client_secret=%5BREDACTED%5D") || !strings.Contains(form, "client_id=app") {
+		t.Fatalf("token request body = %q, want redacted client secret", form)
+	}
+
+	headers := sent[1].args["headers"].(map[string]string)
+	if headers["Authorization"] != redacted || headers["proxy-authorization"] != redacted {
+		t.Fatalf("push request headers = %v, want redacted credentials", headers)
+	}
+	if headers["Content-Type"] != "application/json;charset=utf-8" {
+		t.Fatalf("push request headers = %v, want content type kept", headers)
+	}
+	if body := sent[1].args["body"]; body != `{"message":{"token":["device"]}}` {
+		t.Fatalf("push request body = %v, want it logged as is", body)
+	}
+
+	// request passed to next transport keeps credentials
+	if pushReq.Headers["Authorization"] != "Bearer top-secret" {
+		t.Fatal("authorization header of request was modified")
+	}
+}
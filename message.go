@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"regexp"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -37,6 +38,22 @@ func (t TTL) MarshalJSON() ([]byte, error) {
 	return json.Marshal(s)
 }
 
+// UnmarshalJSON parses duration in seconds with S suffix, for example "86400S" or "1.5S"
+func (t *TTL) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return err
+	}
+
+	sec, err := strconv.ParseFloat(strings.TrimRight(s, "sS"), 64)
+	if err != nil {
+		return fmt.Errorf("invalid ttl %q", s)
+	}
+
+	t.t = time.Duration(sec * float64(time.Second))
+	return nil
+}
+
 // HuaweiMessage represents list of request params and payload for push api
 type HuaweiMessage struct {
 	// ValidateOnly indicates whether a message is test or not.
@@ -64,6 +81,11 @@ func (hr *HuaweiMessage) Validate() error {
 	if err := validateWebPushConfig(hr.Message.WebPush); err != nil {
 		return err
 	}
+
+	// validate apns config
+	if err := validateApnsConfig(hr.Message.Apns); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -102,8 +124,7 @@ type Message struct {
 
 	// iOS push message control
 	// This parameter is mandatory for iOS messages.
-	// block is empty, because corresponding documentation is missing
-	Apns interface{} `json:"apns,omitempty"`
+	Apns *ApnsConfig `json:"apns,omitempty"`
 
 	// Web app push message control.
 	// This parameter is mandatory for iOS messages.
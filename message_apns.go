@@ -0,0 +1,295 @@
+package hms
+
+import (
+	"encoding/json"
+	"errors"
+	"regexp"
+)
+
+var (
+	apnsIdPattern = regexp.MustCompile("^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$")
+)
+
+const (
+	// max size of apns-collapse-id header in bytes
+	maxApnsCollapseIdLen = 64
+)
+
+type ApnsConfig struct {
+	// APNs message header
+	Headers *ApnsHeaders `json:"headers,omitempty"`
+
+	// APNs message payload
+	Payload *ApnsPayload `json:"payload,omitempty"`
+
+	// HMS agent parameter
+	// This parameter is mandatory for iOS messages.
+	HmsOptions *ApnsHmsOptions `json:"hms_options,omitempty"`
+}
+
+type ApnsHeaders struct {
+	// Message ID in canonical UUID format, for example 123e4567-e89b-12d3-a456-4266554400a0.
+	// It's returned to app server if message delivery fails.
+	ApnsId string `json:"apns-id,omitempty"`
+
+	// Message priority. The value can only be 5 or 10.
+	ApnsPriority ApnsPriority `json:"apns-priority,omitempty"`
+
+	// Message expiration time as UNIX timestamp in seconds.
+	// If it's 0, APNs tries to deliver message only once.
+	ApnsExpiration int64 `json:"apns-expiration,omitempty"`
+
+	// Messages with same ID are collapsed and the latest one is displayed.
+	// The value can't be longer than 64 bytes.
+	ApnsCollapseId string `json:"apns-collapse-id,omitempty"`
+}
+
+type ApnsPayload struct {
+	// Apple defined message structure.
+	Aps *Aps `json:"aps,omitempty"`
+
+	// Custom keys sent to app next to aps dictionary.
+	Custom map[string]interface{} `json:"-"`
+}
+
+func (p ApnsPayload) MarshalJSON() ([]byte, error) {
+	payload := make(map[string]interface{}, len(p.Custom)+1)
+	for key, value := range p.Custom {
+		payload[key] = value
+	}
+
+	if p.Aps != nil {
+		payload["aps"] = p.Aps
+	}
+
+	return json.Marshal(payload)
+}
+
+func (p *ApnsPayload) UnmarshalJSON(data []byte) error {
+	var payload map[string]json.RawMessage
+	if err := json.Unmarshal(data, &payload); err != nil {
+		return err
+	}
+
+	*p = ApnsPayload{}
+	if aps, ok := payload["aps"]; ok {
+		if err := json.Unmarshal(aps, &p.Aps); err != nil {
+			return err
+		}
+		delete(payload, "aps")
+	}
+
+	for key, raw := range payload {
+		var value interface{}
+		if err := json.Unmarshal(raw, &value); err != nil {
+			return err
+		}
+
+		if p.Custom == nil {
+			p.Custom = make(map[string]interface{}, len(payload))
+		}
+		p.Custom[key] = value
+	}
+
+	return nil
+}
+
+type Aps struct {
+	// Notification message content.
+	Alert *ApsAlert `json:"alert,omitempty"`
+
+	// Number displayed on app icon. 0 removes badge, nil leaves it unchanged.
+	Badge *int `json:"badge,omitempty"`
+
+	// Name of sound file in app bundle or "default" for system sound.
+	Sound string `json:"sound,omitempty"`
+
+	// Category of notification, which defines actions displayed with it.
+	Category string `json:"category,omitempty"`
+
+	// Notifications with same thread ID are grouped.
+	ThreadId string `json:"thread-id,omitempty"`
+
+	// 1 indicates that notification service extension can modify message content. The value can only be 0 or 1.
+	MutableContent int `json:"mutable-content,omitempty"`
+
+	// 1 indicates background update notification. The value can only be 0 or 1.
+	ContentAvailable int `json:"content-available,omitempty"`
+}
+
+type ApsAlert struct {
+	// Notification message title.
+	Title string `json:"title,omitempty"`
+
+	// Notification message subtitle.
+	Subtitle string `json:"subtitle,omitempty"`
+
+	// Notification message content.
+	Body string `json:"body,omitempty"`
+
+	// Key of localized title string in app bundle.
+	TitleLocKey string `json:"title-loc-key,omitempty"`
+
+	// Arguments substituted into localized title.
+	TitleLocArgs []string `json:"title-loc-args,omitempty"`
+
+	// Key of localized body string in app bundle.
+	LocKey string `json:"loc-key,omitempty"`
+
+	// Arguments substituted into localized body.
+	LocArgs []string `json:"loc-args,omitempty"`
+
+	// Name of image file displayed while app is launching.
+	LaunchImage string `json:"launch-image,omitempty"`
+}
+
+type ApnsHmsOptions struct {
+	// Type of target users. The value can be 1 (test user), 2 (formal user) or 3 (VoIP user).
+	TargetUserType ApnsTargetUserType `json:"target_user_type"`
+}
+
+type ApnsPriority string
+
+const (
+	ApnsPriorityImmediate   ApnsPriority = "10"
+	ApnsPriorityPowerSaving ApnsPriority = "5"
+)
+
+func (p ApnsPriority) MarshalJSON() ([]byte, error) {
+	switch p {
+	case ApnsPriorityImmediate, ApnsPriorityPowerSaving:
+		return json.Marshal(string(p))
+	}
+
+	return nil, errors.New("Invalid apns priority type")
+}
+
+type ApnsTargetUserType int
+
+const (
+	ApnsTargetUserTest ApnsTargetUserType = iota + 1
+	ApnsTargetUserFormal
+	ApnsTargetUserVoIP
+)
+
+func (t ApnsTargetUserType) MarshalJSON() ([]byte, error) {
+	switch t {
+	case ApnsTargetUserTest, ApnsTargetUserFormal, ApnsTargetUserVoIP:
+		return json.Marshal(int(t))
+	}
+
+	return nil, errors.New("Invalid apns target user type")
+}
+
+func validateApnsConfig(apnsConfig *ApnsConfig) error {
+	if apnsConfig == nil {
+		return nil
+	}
+
+	if err := validateApnsHmsOptions(apnsConfig.HmsOptions); err != nil {
+		return err
+	}
+
+	if err := validateApnsHeaders(apnsConfig.Headers); err != nil {
+		return err
+	}
+
+	return validateApnsPayload(apnsConfig.Payload)
+}
+
+func validateApnsHmsOptions(options *ApnsHmsOptions) error {
+	if options == nil {
+		return errors.New("hms_options must not be null")
+	}
+
+	switch options.TargetUserType {
+	case ApnsTargetUserTest, ApnsTargetUserFormal, ApnsTargetUserVoIP:
+		return nil
+	}
+	return errors.New("target_user_type must be in the interval [1 - 3]")
+}
+
+func validateApnsHeaders(headers *ApnsHeaders) error {
+	if headers == nil {
+		return nil
+	}
+
+	if headers.ApnsId != "" && !apnsIdPattern.MatchString(headers.ApnsId) {
+		return errors.New("apns-id must be in canonical UUID format")
+	}
+
+	switch headers.ApnsPriority {
+	case "", ApnsPriorityImmediate, ApnsPriorityPowerSaving:
+	default:
+		return errors.New("apns-priority must be 5 or 10")
+	}
+
+	if headers.ApnsExpiration < 0 {
+		return errors.New("apns-expiration can't be negative")
+	}
+
+	if len(headers.ApnsCollapseId) > maxApnsCollapseIdLen {
+		return errors.New("apns-collapse-id can't be longer than 64 bytes")
+	}
+
+	return nil
+}
+
+func validateApnsPayload(payload *ApnsPayload) error {
+	if payload == nil {
+		return nil
+	}
+
+	if _, ok := payload.Custom["aps"]; ok {
+		return errors.New("custom payload keys must not contain aps")
+	}
+
+	return validateAps(payload.Aps)
+}
+
+func validateAps(aps *Aps) error {
+	if aps == nil {
+		return nil
+	}
+
+	if aps.Badge != nil && *aps.Badge < 0 {
+		return errors.New("badge can't be negative")
+	}
+
+	if aps.MutableContent != 0 && aps.MutableContent != 1 {
+		return errors.New("mutable-content must be 0 or 1")
+	}
+
+	if aps.ContentAvailable != 0 && aps.ContentAvailable != 1 {
+		return errors.New("content-available must be 0 or 1")
+	}
+
+	return nil
+}
+
+func GetDefaultApns() *ApnsConfig {
+	return &ApnsConfig{
+		Headers: &ApnsHeaders{
+			ApnsPriority: ApnsPriorityImmediate,
+		},
+		Payload: &ApnsPayload{
+			Aps: &Aps{
+				Sound: "default",
+			},
+		},
+		HmsOptions: &ApnsHmsOptions{
+			TargetUserType: ApnsTargetUserFormal,
+		},
+	}
+}
+
+func GetDefaultApnsNotificationMessage(tokenArr []string) *HuaweiMessage {
+	msg := NewNotificationMsgRequest()
+	msg.Message.Token = tokenArr
+	msg.Message.Apns = GetDefaultApns()
+	msg.Message.Apns.Payload.Aps.Alert = &ApsAlert{
+		Title: "notification title",
+		Body:  "Notification body text",
+	}
+	return msg
+}
@@ -0,0 +1,113 @@
+package hms
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestApnsConfigMarshal(t *testing.T) {
+	msg := GetDefaultApnsNotificationMessage([]string{"device"})
+	badge := 0
+	msg.Message.Apns.Payload.Aps.Badge = &badge
+	msg.Message.Apns.Payload.Aps.ThreadId = "orders"
+	msg.Message.Apns.Payload.Aps.MutableContent = 1
+	msg.Message.Apns.Payload.Custom = map[string]interface{}{"deeplink": "app://orders/1"}
+	msg.Message.Apns.Headers.ApnsCollapseId = "order-1"
+
+	if err := msg.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := json.Marshal(msg.Message.Apns)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var got map[string]interface{}
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]interface{}{
+		"headers": map[string]interface{}{
+			"apns-priority":    "10",
+			"apns-collapse-id": "order-1",
+		},
+		"payload": map[string]interface{}{
+			"aps": map[string]interface{}{
+				"alert": map[string]interface{}{
+					"title": "notification title",
+					"body":  "Notification body text",
+				},
+				"badge":           float64(0),
+				"sound":           "default",
+				"thread-id":       "orders",
+				"mutable-content": float64(1),
+			},
+			"deeplink": "app://orders/1",
+		},
+		"hms_options": map[string]interface{}{
+			"target_user_type": float64(2),
+		},
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("marshalled apns config = %s", data)
+	}
+}
+
+func TestApnsPayloadUnmarshal(t *testing.T) {
+	var payload ApnsPayload
+	if err := json.Unmarshal([]byte(`{"aps":{"sound":"default","badge":2},"deeplink":"app://x"}`), &payload); err != nil {
+		t.Fatal(err)
+	}
+
+	if payload.Aps == nil || payload.Aps.Sound != "default" || payload.Aps.Badge == nil || *payload.Aps.Badge != 2 {
+		t.Fatalf("aps = %+v", payload.Aps)
+	}
+	if !reflect.DeepEqual(payload.Custom, map[string]interface{}{"deeplink": "app://x"}) {
+		t.Fatalf("custom keys = %v", payload.Custom)
+	}
+}
+
+func TestApnsConfigValidate(t *testing.T) {
+	negative := -1
+
+	tests := []struct {
+		name   string
+		modify func(apns *ApnsConfig)
+		err    string
+	}{
+		{"default", func(apns *ApnsConfig) {}, ""},
+		{"missing hms options", func(apns *ApnsConfig) { apns.HmsOptions = nil }, "hms_options"},
+		{"target user type", func(apns *ApnsConfig) { apns.HmsOptions.TargetUserType = 4 }, "target_user_type"},
+		{"apns id", func(apns *ApnsConfig) { apns.Headers.ApnsId = "not-uuid" }, "apns-id"},
+		{"valid apns id", func(apns *ApnsConfig) { apns.Headers.ApnsId = "123e4567-e89b-12d3-a456-4266554400a0" }, ""},
+		{"priority", func(apns *ApnsConfig) { apns.Headers.ApnsPriority = "7" }, "apns-priority"},
+		{"expiration", func(apns *ApnsConfig) { apns.Headers.ApnsExpiration = -1 }, "apns-expiration"},
+		{"collapse id", func(apns *ApnsConfig) { apns.Headers.ApnsCollapseId = strings.Repeat("x", 65) }, "apns-collapse-id"},
+		{"badge", func(apns *ApnsConfig) { apns.Payload.Aps.Badge = &negative }, "badge"},
+		{"mutable content", func(apns *ApnsConfig) { apns.Payload.Aps.MutableContent = 2 }, "mutable-content"},
+		{"content available", func(apns *ApnsConfig) { apns.Payload.Aps.ContentAvailable = 2 }, "content-available"},
+		{"custom aps", func(apns *ApnsConfig) { apns.Payload.Custom = map[string]interface{}{"aps": 1} }, "aps"},
+	}
+
+	for _, tt := range tests {
+		msg := GetDefaultApnsNotificationMessage([]string{"device"})
+		tt.modify(msg.Message.Apns)
+
+		err := msg.Validate()
+		if tt.err == "" {
+			if err != nil {
+				t.Errorf("%s: unexpected error %v", tt.name, err)
+			}
+			continue
+		}
+
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: error = %v, want error about %s", tt.name, err, tt.err)
+		}
+	}
+}
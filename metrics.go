@@ -0,0 +1,217 @@
+package hms
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// DefaultLatencyBuckets are upper bounds in seconds of latency histograms
+	DefaultLatencyBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+	// DefaultBatchSizeBuckets are upper bounds of batch size histogram
+	DefaultBatchSizeBuckets = []float64{1, 10, 100, 500, 1000, 5000, 10000, 50000, 100000}
+)
+
+// Metrics receives measurements of client and transport operations
+type Metrics interface {
+	// ObserveSend is called when SendMessage completes. Code is empty if request failed without response
+	ObserveSend(code ResponseCode, duration time.Duration)
+
+	// ObserveTokenRefresh is called when access token refresh completes
+	ObserveTokenRefresh(success bool, duration time.Duration)
+
+	// ObserveBatchSize is called with number of tokens passed to SendBatch
+	ObserveBatchSize(tokens int)
+
+	// ObserveRequest is called when http request attempt completes. Status is zero if attempt failed without response
+	ObserveRequest(status int, duration time.Duration)
+
+	// IncRetry is called before failed http request is retried
+	IncRetry(status int)
+}
+
+// nopMetrics discards all measurements, it's used when metrics aren't set
+type nopMetrics struct{}
+
+func (nopMetrics) ObserveSend(code ResponseCode, duration time.Duration)    {}
+func (nopMetrics) ObserveTokenRefresh(success bool, duration time.Duration) {}
+func (nopMetrics) ObserveBatchSize(tokens int)                              {}
+func (nopMetrics) ObserveRequest(status int, duration time.Duration)        {}
+func (nopMetrics) IncRetry(status int)                                      {}
+
+// InMemoryMetrics aggregates measurements in memory and renders them in prometheus text exposition format
+type InMemoryMetrics struct {
+	mu sync.Mutex
+
+	sends           *counterVec
+	sendDuration    *histogram
+	tokenRefreshes  *counterVec
+	refreshDuration *histogram
+	batchSize       *histogram
+	requests        *counterVec
+	requestDuration *histogram
+	retries         *counterVec
+}
+
+func NewInMemoryMetrics() *InMemoryMetrics {
+	return &InMemoryMetrics{
+		sends:           newCounterVec("hms_push_sends_total", "Number of sent messages by push server response code.", "code"),
+		sendDuration:    newHistogram("hms_push_send_duration_seconds", "Duration of sending message including token refresh and retries.", DefaultLatencyBuckets),
+		tokenRefreshes:  newCounterVec("hms_push_token_refreshes_total", "Number of access token refreshes by result.", "result"),
+		refreshDuration: newHistogram("hms_push_token_refresh_duration_seconds", "Duration of access token refresh.", DefaultLatencyBuckets),
+		batchSize:       newHistogram("hms_push_batch_size", "Number of tokens passed to batch send.", DefaultBatchSizeBuckets),
+		requests:        newCounterVec("hms_push_http_requests_total", "Number of http request attempts by response status.", "status"),
+		requestDuration: newHistogram("hms_push_http_request_duration_seconds", "Duration of single http request attempt.", DefaultLatencyBuckets),
+		retries:         newCounterVec("hms_push_http_retries_total", "Number of retried http requests by status of failed attempt.", "status"),
+	}
+}
+
+func (m *InMemoryMetrics) ObserveSend(code ResponseCode, duration time.Duration) {
+	if code == "" {
+		code = "error"
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sends.inc(string(code))
+	m.sendDuration.observe(duration.Seconds())
+}
+
+func (m *InMemoryMetrics) ObserveTokenRefresh(success bool, duration time.Duration) {
+	result := "success"
+	if !success {
+		result = "error"
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.tokenRefreshes.inc(result)
+	m.refreshDuration.observe(duration.Seconds())
+}
+
+func (m *InMemoryMetrics) ObserveBatchSize(tokens int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.batchSize.observe(float64(tokens))
+}
+
+func (m *InMemoryMetrics) ObserveRequest(status int, duration time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.requests.inc(strconv.Itoa(status))
+	m.requestDuration.observe(duration.Seconds())
+}
+
+func (m *InMemoryMetrics) IncRetry(status int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.retries.inc(strconv.Itoa(status))
+}
+
+// WritePrometheus writes all metrics in prometheus text exposition format
+func (m *InMemoryMetrics) WritePrometheus(w io.Writer) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	bw := bufio.NewWriter(w)
+	m.sends.write(bw)
+	m.sendDuration.write(bw)
+	m.tokenRefreshes.write(bw)
+	m.refreshDuration.write(bw)
+	m.batchSize.write(bw)
+	m.requests.write(bw)
+	m.requestDuration.write(bw)
+	m.retries.write(bw)
+
+	return bw.Flush()
+}
+
+// ServeHTTP serves metrics to prometheus scraper
+func (m *InMemoryMetrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WritePrometheus(w)
+}
+
+// counterVec is counter partitioned by values of single label
+type counterVec struct {
+	name   string
+	help   string
+	label  string
+	values map[string]float64
+}
+
+func newCounterVec(name, help, label string) *counterVec {
+	return &counterVec{name: name, help: help, label: label, values: make(map[string]float64)}
+}
+
+func (c *counterVec) inc(labelValue string) {
+	c.values[labelValue]++
+}
+
+func (c *counterVec) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n", c.name, c.help, c.name)
+
+	labelValues := make([]string, 0, len(c.values))
+	for labelValue := range c.values {
+		labelValues = append(labelValues, labelValue)
+	}
+	sort.Strings(labelValues)
+
+	for _, labelValue := range labelValues {
+		fmt.Fprintf(w, "%s{%s=\"%s\"} %s\n", c.name, c.label, labelEscaper.Replace(labelValue), formatFloat(c.values[labelValue]))
+	}
+}
+
+// labelEscaper escapes label value as required by text exposition format, which differs from go quoting
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// histogram counts observations in cumulative buckets
+type histogram struct {
+	name    string
+	help    string
+	bounds  []float64
+	buckets []uint64
+	sum     float64
+	count   uint64
+}
+
+func newHistogram(name, help string, bounds []float64) *histogram {
+	return &histogram{name: name, help: help, bounds: bounds, buckets: make([]uint64, len(bounds))}
+}
+
+func (h *histogram) observe(value float64) {
+	for i, bound := range h.bounds {
+		if value <= bound {
+			h.buckets[i]++
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+func (h *histogram) write(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s histogram\n", h.name, h.help, h.name)
+	for i, bound := range h.bounds {
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", h.name, formatFloat(bound), h.buckets[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.name, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n", h.name, formatFloat(h.sum))
+	fmt.Fprintf(w, "%s_count %d\n", h.name, h.count)
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', -1, 64)
+}
@@ -0,0 +1,53 @@
+package hms
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+	"time"
+)
+
+func TestInMemoryMetricsWritePrometheus(t *testing.T) {
+	m := NewInMemoryMetrics()
+	m.ObserveSend(SuccessCode, 250*time.Millisecond)
+	m.ObserveSend(SuccessCode, 2*time.Second)
+	m.ObserveSend("", 500*time.Millisecond)
+	m.ObserveTokenRefresh(true, 125*time.Millisecond)
+	m.ObserveTokenRefresh(false, 20*time.Second)
+	m.ObserveBatchSize(3)
+	m.ObserveBatchSize(600)
+	m.ObserveRequest(500, 250*time.Millisecond)
+	m.ObserveRequest(200, 1500*time.Millisecond)
+	m.ObserveRequest(0, 4*time.Millisecond)
+	m.IncRetry(500)
+
+	var buf bytes.Buffer
+	if err := m.WritePrometheus(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := ioutil.ReadFile("testdata/metrics.golden")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("metrics output:\n%s\nwant:\n%s", buf.Bytes(), want)
+	}
+}
+
+func TestCounterVecEscapesLabelValue(t *testing.T) {
+	c := newCounterVec("test_total", "Test counter.", "value")
+	c.inc("a\\b \"c\"\nd")
+	c.inc("ü")
+
+	var buf bytes.Buffer
+	c.write(&buf)
+
+	want := "# HELP test_total Test counter.\n" +
+		"# TYPE test_total counter\n" +
+		`test_total{value="a\\b \"c\"\nd"} 1` + "\n" +
+		`test_total{value="ü"} 1` + "\n"
+	if buf.String() != want {
+		t.Fatalf("counter output:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
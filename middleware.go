@@ -0,0 +1,93 @@
+package hms
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// TransporterFunc is an adapter to use ordinary function as Transporter
+type TransporterFunc func(ctx context.Context, req *HttpRequest) (*HttpResponse, error)
+
+func (f TransporterFunc) Send(ctx context.Context, req *HttpRequest) (*HttpResponse, error) {
+	return f(ctx, req)
+}
+
+// Middleware wraps transport to intercept requests and responses
+type Middleware func(next Transporter) Transporter
+
+// Chain wraps transport with middlewares. First middleware is the outermost one
+func Chain(transport Transporter, middlewares ...Middleware) Transporter {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		transport = middlewares[i](transport)
+	}
+	return transport
+}
+
+// HeaderMiddleware sets headers to every request
+func HeaderMiddleware(headers map[string]string) Middleware {
+	return func(next Transporter) Transporter {
+		return TransporterFunc(func(ctx context.Context, req *HttpRequest) (*HttpResponse, error) {
+			for header, value := range headers {
+				req.SetHeader(header, value)
+			}
+			return next.Send(ctx, req)
+		})
+	}
+}
+
+// UserAgentMiddleware sets User-Agent header to every request
+func UserAgentMiddleware(userAgent string) Middleware {
+	return HeaderMiddleware(map[string]string{"User-Agent": userAgent})
+}
+
+// TimeoutMiddleware limits time of sending request including all its retries
+func TimeoutMiddleware(timeout time.Duration) Middleware {
+	return func(next Transporter) Transporter {
+		return TransporterFunc(func(ctx context.Context, req *HttpRequest) (*HttpResponse, error) {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			resp, err := next.Send(ctx, req)
+			if err != nil || resp == nil {
+				cancel()
+				return resp, err
+			}
+
+			// response body is read after Send returns, so context is cancelled when body is closed
+			resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+			return resp, nil
+		})
+	}
+}
+
+// FaultInjectionMiddleware responds to random requests with status instead of sending them.
+// Probability is in interval [0, 1]. It's intended for chaos testing of error handling
+func FaultInjectionMiddleware(probability float64, status int) Middleware {
+	return func(next Transporter) Transporter {
+		return TransporterFunc(func(ctx context.Context, req *HttpRequest) (*HttpResponse, error) {
+			if rand.Float64() >= probability {
+				return next.Send(ctx, req)
+			}
+
+			return &HttpResponse{
+				Status: status,
+				Header: make(http.Header),
+				Body:   ioutil.NopCloser(strings.NewReader(http.StatusText(status))),
+			}, nil
+		})
+	}
+}
+
+// cancelOnClose cancels context of request when response body is closed
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	defer c.cancel()
+	return c.ReadCloser.Close()
+}
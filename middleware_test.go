@@ -0,0 +1,127 @@
+package hms
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// okTransport answers every request with empty success response
+var okTransport = TransporterFunc(func(ctx context.Context, req *HttpRequest) (*HttpResponse, error) {
+	return &HttpResponse{Status: http.StatusOK, Header: make(http.Header), Body: ioutil.NopCloser(strings.NewReader("ok"))}, nil
+})
+
+func TestChainOrder(t *testing.T) {
+	var calls []string
+	record := func(name string) Middleware {
+		return func(next Transporter) Transporter {
+			return TransporterFunc(func(ctx context.Context, req *HttpRequest) (*HttpResponse, error) {
+				calls = append(calls, name+" before")
+				resp, err := next.Send(ctx, req)
+				calls = append(calls, name+" after")
+				return resp, err
+			})
+		}
+	}
+
+	transport := TransporterFunc(func(ctx context.Context, req *HttpRequest) (*HttpResponse, error) {
+		calls = append(calls, "transport")
+		return okTransport(ctx, req)
+	})
+
+	if _, err := Chain(transport, record("first"), record("second")).Send(context.Background(), NewHTTPRequest()); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"first before", "second before", "transport", "second after", "first after"}
+	if !reflect.DeepEqual(calls, want) {
+		t.Fatalf("calls = %v, want %v", calls, want)
+	}
+}
+
+func TestHeaderMiddleware(t *testing.T) {
+	var headers map[string]string
+	transport := TransporterFunc(func(ctx context.Context, req *HttpRequest) (*HttpResponse, error) {
+		headers = req.Headers
+		return okTransport(ctx, req)
+	})
+
+	chain := Chain(transport, HeaderMiddleware(map[string]string{"X-Trace": "trace"}), UserAgentMiddleware("hms-test"))
+	if _, err := chain.Send(context.Background(), NewHTTPRequest()); err != nil {
+		t.Fatal(err)
+	}
+
+	if headers["X-Trace"] != "trace" || headers["User-Agent"] != "hms-test" {
+		t.Fatalf("headers = %v", headers)
+	}
+}
+
+func TestTimeoutMiddlewareKeepsContextUntilBodyClosed(t *testing.T) {
+	var sendCtx context.Context
+	transport := TransporterFunc(func(ctx context.Context, req *HttpRequest) (*HttpResponse, error) {
+		sendCtx = ctx
+		return okTransport(ctx, req)
+	})
+
+	resp, err := Chain(transport, TimeoutMiddleware(time.Minute)).Send(context.Background(), NewHTTPRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := sendCtx.Deadline(); !ok {
+		t.Fatal("context of request has no deadline")
+	}
+
+	// body is read after Send returns
+	if err := sendCtx.Err(); err != nil {
+		t.Fatalf("context error before body is closed = %v", err)
+	}
+	if body, err := ioutil.ReadAll(resp.Body); err != nil || string(body) != "ok" {
+		t.Fatalf("body = %q, %v", body, err)
+	}
+
+	resp.Body.Close()
+	if err := sendCtx.Err(); err != context.Canceled {
+		t.Fatalf("context error after body is closed = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestTimeoutMiddlewareCancelsContextOnError(t *testing.T) {
+	sendErr := errors.New("send failed")
+
+	var sendCtx context.Context
+	transport := TransporterFunc(func(ctx context.Context, req *HttpRequest) (*HttpResponse, error) {
+		sendCtx = ctx
+		return nil, sendErr
+	})
+
+	if _, err := Chain(transport, TimeoutMiddleware(time.Minute)).Send(context.Background(), NewHTTPRequest()); err != sendErr {
+		t.Fatalf("error = %v, want %v", err, sendErr)
+	}
+	if err := sendCtx.Err(); err != context.Canceled {
+		t.Fatalf("context error = %v, want %v", err, context.Canceled)
+	}
+}
+
+func TestFaultInjectionMiddleware(t *testing.T) {
+	resp, err := Chain(okTransport, FaultInjectionMiddleware(1, http.StatusServiceUnavailable)).Send(context.Background(), NewHTTPRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != http.StatusServiceUnavailable {
+		t.Fatalf("status = %d, want %d", resp.Status, http.StatusServiceUnavailable)
+	}
+
+	resp, err = Chain(okTransport, FaultInjectionMiddleware(0, http.StatusServiceUnavailable)).Send(context.Background(), NewHTTPRequest())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Status != http.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.Status, http.StatusOK)
+	}
+}
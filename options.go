@@ -0,0 +1,315 @@
+package hms
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Option configures HuaweiClient created by NewHuaweiClient
+type Option func(c *HuaweiClient) error
+
+// WithTransport sets transport used to send requests instead of default HttpTransport
+func WithTransport(transport Transporter) Option {
+	return func(c *HuaweiClient) error {
+		return c.SetTransport(transport)
+	}
+}
+
+// WithTransportOptions configures default HttpTransport of client.
+// It can't be combined with WithTransport
+func WithTransportOptions(opts ...TransportOption) Option {
+	return func(c *HuaweiClient) error {
+		c.transportOpts = append(c.transportOpts, opts...)
+		return nil
+	}
+}
+
+// WithMiddleware wraps client transport with middlewares. First middleware is the outermost one,
+// so it sees request first and response last
+func WithMiddleware(middlewares ...Middleware) Option {
+	return func(c *HuaweiClient) error {
+		for _, middleware := range middlewares {
+			if middleware == nil {
+				return errors.New("passed empty middleware")
+			}
+		}
+		c.middlewares = append(c.middlewares, middlewares...)
+
+		return nil
+	}
+}
+
+// WithHTTPClient sets http client used by default transport
+func WithHTTPClient(client *http.Client) Option {
+	return WithTransportOptions(TransportHTTPClient(client))
+}
+
+// WithTimeout sets timeout of every http request attempt of default transport
+func WithTimeout(timeout time.Duration) Option {
+	return WithTransportOptions(TransportTimeout(timeout))
+}
+
+// WithRetryPolicy sets number of request attempts and backoff between them for default transport
+func WithRetryPolicy(retryCount int, backoff BackoffPolicy) Option {
+	return WithTransportOptions(TransportRetryCount(retryCount), TransportBackoff(backoff))
+}
+
+// WithEndpoints sets addresses of oauth and push servers, for example one of regional presets
+func WithEndpoints(endpoints Endpoints) Option {
+	return func(c *HuaweiClient) error {
+		return c.SetEndpoints(endpoints)
+	}
+}
+
+// WithBaseURL sends both oauth and push requests to single server, for example local mock server
+func WithBaseURL(baseURL string) Option {
+	return WithEndpoints(NewEndpoints(baseURL))
+}
+
+// WithLogger sets logger of client events. It's also used by default transport
+// unless transport logger is set with transport options
+func WithLogger(logger Logger) Option {
+	return func(c *HuaweiClient) error {
+		return c.SetLogger(logger)
+	}
+}
+
+// WithMetrics sets collector of client measurements. It's also used by default transport
+// unless transport metrics are set with transport options
+func WithMetrics(metrics Metrics) Option {
+	return func(c *HuaweiClient) error {
+		return c.SetMetrics(metrics)
+	}
+}
+
+// WithTracer sets tracer of client operations. It's also used by default transport
+// unless transport tracer is set with transport options
+func WithTracer(tracer Tracer) Option {
+	return func(c *HuaweiClient) error {
+		return c.SetTracer(tracer)
+	}
+}
+
+// WithCircuitBreaker sets circuit breaker of default transport. Oauth and push requests share it,
+// scope it with SetURLPrefix to check only push requests
+func WithCircuitBreaker(cb *CircuitBreaker) Option {
+	return WithTransportOptions(TransportCircuitBreaker(cb))
+}
+
+// WithTokenSource sets source of access tokens instead of default client credentials flow
+func WithTokenSource(tokenSource TokenSource) Option {
+	return func(c *HuaweiClient) error {
+		return c.SetTokenSource(tokenSource)
+	}
+}
+
+// WithTokenStore sets storage shared between clients which is checked before requesting new token
+func WithTokenStore(store TokenStore) Option {
+	return func(c *HuaweiClient) error {
+		return c.SetTokenStore(store)
+	}
+}
+
+// WithPushRateLimiter sets limiter of requests to push server including retries of default transport
+func WithPushRateLimiter(limiter *RateLimiter) Option {
+	return func(c *HuaweiClient) error {
+		return c.SetPushRateLimiter(limiter)
+	}
+}
+
+// WithAuthRateLimiter sets limiter of requests to token source
+func WithAuthRateLimiter(limiter *RateLimiter) Option {
+	return func(c *HuaweiClient) error {
+		return c.SetAuthRateLimiter(limiter)
+	}
+}
+
+// WithTokenRefreshMargin sets how long before token expiration it should be refreshed.
+// Tokens living shorter than twice the margin are refreshed in the middle of their lifetime
+func WithTokenRefreshMargin(margin time.Duration) Option {
+	return func(c *HuaweiClient) error {
+		return c.SetTokenRefreshMargin(margin)
+	}
+}
+
+// WithHMSErrors enables returning non-success response codes from SendMessage as *HMSError
+func WithHMSErrors() Option {
+	return func(c *HuaweiClient) error {
+		c.SetHMSErrors(true)
+		return nil
+	}
+}
+
+// WithInvalidTokenHandler sets handler of device tokens reported by push server as invalid
+func WithInvalidTokenHandler(handler InvalidTokenHandler) Option {
+	return func(c *HuaweiClient) error {
+		return c.SetInvalidTokenHandler(handler)
+	}
+}
+
+// WithBatchConcurrency sets max number of requests sent concurrently by SendBatch
+func WithBatchConcurrency(concurrency int) Option {
+	return func(c *HuaweiClient) error {
+		return c.SetBatchConcurrency(concurrency)
+	}
+}
+
+// TransportOption configures HttpTransport created by NewTransport. Options are applied in order,
+// so TLS and proxy options must follow TransportHTTPClient to configure provided client
+type TransportOption func(tr *HttpTransport) error
+
+// TransportHTTPClient sets http client used to send requests.
+// TLS and proxy can be configured only if client uses *http.Transport.
+// Client and its transport are copied, so passed ones aren't modified by other options
+func TransportHTTPClient(client *http.Client) TransportOption {
+	return func(tr *HttpTransport) error {
+		if client == nil {
+			return errors.New("passed empty http client")
+		}
+
+		c := *client
+		tr.transport = nil
+		if transport, ok := client.Transport.(*http.Transport); ok {
+			tr.transport = transport.Clone()
+			c.Transport = tr.transport
+		}
+		tr.client = &c
+
+		return nil
+	}
+}
+
+// TransportTimeout sets timeout of every request attempt
+func TransportTimeout(timeout time.Duration) TransportOption {
+	return func(tr *HttpTransport) error {
+		if timeout < 0 {
+			return errors.New("timeout can't be negative")
+		}
+
+		// copy client, so http client passed by caller isn't modified
+		client := *tr.client
+		client.Timeout = timeout
+		tr.client = &client
+
+		return nil
+	}
+}
+
+// TransportRetryCount sets max number of request attempts. At least one attempt is always made
+func TransportRetryCount(retryCount int) TransportOption {
+	return func(tr *HttpTransport) error {
+		if retryCount < 0 {
+			return errors.New("retry count can't be negative")
+		}
+		tr.maxRetryTimes = retryCount
+
+		return nil
+	}
+}
+
+// TransportBackoff sets policy which decides how long to wait before retrying failed request
+func TransportBackoff(backoff BackoffPolicy) TransportOption {
+	return func(tr *HttpTransport) error {
+		return tr.SetBackoffPolicy(backoff)
+	}
+}
+
+// TransportMaxRetryDuration limits total time of all request attempts
+func TransportMaxRetryDuration(duration time.Duration) TransportOption {
+	return func(tr *HttpTransport) error {
+		return tr.SetMaxRetryDuration(duration)
+	}
+}
+
+// TransportMaxRetryAfter sets max delay taken from Retry-After header
+func TransportMaxRetryAfter(max time.Duration) TransportOption {
+	return func(tr *HttpTransport) error {
+		return tr.SetMaxRetryAfter(max)
+	}
+}
+
+// TransportRetryHook sets hook which is called before every retry of request
+func TransportRetryHook(hook RetryHook) TransportOption {
+	return func(tr *HttpTransport) error {
+		return tr.SetRetryHook(hook)
+	}
+}
+
+// TransportLogger sets logger of request attempts and retries
+func TransportLogger(logger Logger) TransportOption {
+	return func(tr *HttpTransport) error {
+		return tr.SetLogger(logger)
+	}
+}
+
+// TransportMetrics sets collector of request attempts and retries measurements
+func TransportMetrics(metrics Metrics) TransportOption {
+	return func(tr *HttpTransport) error {
+		return tr.SetMetrics(metrics)
+	}
+}
+
+// TransportTracer sets tracer which creates span for every request attempt
+func TransportTracer(tracer Tracer) TransportOption {
+	return func(tr *HttpTransport) error {
+		return tr.SetTracer(tracer)
+	}
+}
+
+// TransportCircuitBreaker sets circuit breaker which stops sending requests while server is unavailable.
+// It checks all requests sent by transport unless scoped with SetURLPrefix
+func TransportCircuitBreaker(cb *CircuitBreaker) TransportOption {
+	return func(tr *HttpTransport) error {
+		return tr.SetCircuitBreaker(cb)
+	}
+}
+
+// TransportProxy sends requests through proxy server
+func TransportProxy(proxyUrl string) TransportOption {
+	return func(tr *HttpTransport) error {
+		proxy, err := url.Parse(proxyUrl)
+		if err != nil {
+			return errors.New("fail parse proxy url")
+		}
+
+		if tr.transport == nil {
+			return errors.New("proxy of custom http client can't be changed")
+		}
+		tr.transport.Proxy = http.ProxyURL(proxy)
+
+		return nil
+	}
+}
+
+// TransportTLSConfig replaces TLS configuration with copy of provided config
+func TransportTLSConfig(config *tls.Config) TransportOption {
+	return func(tr *HttpTransport) error {
+		return tr.SetTLSConfig(config)
+	}
+}
+
+// TransportRootCAs adds PEM encoded certificates to trusted root CAs.
+// It fails if root CAs pool was passed with TLS config or http client, such pool isn't modified
+func TransportRootCAs(pemCerts []byte) TransportOption {
+	return func(tr *HttpTransport) error {
+		return tr.AddRootCAs(pemCerts)
+	}
+}
+
+// TransportClientCertificates sets certificates presented to server for mutual TLS authentication
+func TransportClientCertificates(certs ...tls.Certificate) TransportOption {
+	return func(tr *HttpTransport) error {
+		return tr.SetClientCertificates(certs...)
+	}
+}
+
+// TransportDisableTLSVerificationForTesting turns off verification of server certificates.
+// It must be used only in test environments
+func TransportDisableTLSVerificationForTesting() TransportOption {
+	return func(tr *HttpTransport) error {
+		return tr.DisableTLSVerificationForTesting()
+	}
+}
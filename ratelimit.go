@@ -0,0 +1,196 @@
+package hms
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// rate of throttled limiter doesn't go lower than this part of configured rate
+	minRateFactor = 0.1
+
+	// part of configured rate restored after every successful request
+	rateRecoveryFactor = 0.05
+)
+
+// ErrRateLimited is returned when request is rejected by client side rate limiter
+var ErrRateLimited = errors.New("rate limit exceeded")
+
+// RateLimitMode defines behaviour of rate limiter when limit is exceeded
+type RateLimitMode int
+
+const (
+	// RateLimitWait blocks caller until request is allowed. If it can't be allowed
+	// before context deadline, ErrRateLimited is returned immediately
+	RateLimitWait RateLimitMode = iota
+
+	// RateLimitReject returns ErrRateLimited immediately
+	RateLimitReject
+)
+
+// RateLimiter is token bucket limiter of requests per second. It adapts to throttling responses
+// of server: rate is halved on every throttled request and slowly restored on successful ones
+type RateLimiter struct {
+	mu sync.Mutex
+
+	// configured rate of requests per second
+	limit float64
+	// current rate, lowered after throttling responses
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+	mode   RateLimitMode
+}
+
+// NewRateLimiter creates limiter allowing rps requests per second with bursts of up to burst requests
+func NewRateLimiter(rps float64, burst int, mode RateLimitMode) (*RateLimiter, error) {
+	if rps <= 0 {
+		return nil, errors.New("rate must be positive")
+	}
+
+	if burst < 1 {
+		return nil, errors.New("burst must be positive")
+	}
+
+	return &RateLimiter{
+		limit:  rps,
+		rate:   rps,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   time.Now(),
+		mode:   mode,
+	}, nil
+}
+
+// Wait takes permission for single request according to limiter mode
+func (l *RateLimiter) Wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	l.refill(now)
+
+	if l.tokens >= 1 {
+		l.tokens--
+		l.mu.Unlock()
+		return nil
+	}
+
+	if l.mode == RateLimitReject {
+		l.mu.Unlock()
+		return ErrRateLimited
+	}
+
+	delay := time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+	if deadline, ok := ctx.Deadline(); ok && now.Add(delay).After(deadline) {
+		l.mu.Unlock()
+		return ErrRateLimited
+	}
+
+	// token is reserved in advance, so concurrent callers queue up behind each other
+	l.tokens--
+	l.mu.Unlock()
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		l.mu.Lock()
+		l.tokens++
+		l.mu.Unlock()
+		return ctx.Err()
+	}
+}
+
+// ReportThrottled halves current rate after server responded with throttling error
+func (l *RateLimiter) ReportThrottled() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.refill(time.Now())
+	l.rate /= 2
+	if min := l.limit * minRateFactor; l.rate < min {
+		l.rate = min
+	}
+
+	// drop accumulated burst, server is already overloaded
+	if l.tokens > 0 {
+		l.tokens = 0
+	}
+}
+
+// ReportSuccess restores part of configured rate after successful request
+func (l *RateLimiter) ReportSuccess() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.rate >= l.limit {
+		return
+	}
+
+	l.refill(time.Now())
+	l.rate += l.limit * rateRecoveryFactor
+	if l.rate > l.limit {
+		l.rate = l.limit
+	}
+}
+
+// Rate returns current rate of requests per second
+func (l *RateLimiter) Rate() float64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.rate
+}
+
+// refill adds tokens accumulated since last refill. Caller must hold mu
+func (l *RateLimiter) refill(now time.Time) {
+	l.tokens += now.Sub(l.last).Seconds() * l.rate
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = now
+}
+
+// requestLimiterKey is context key of rate limiter of request passed to transport
+type requestLimiterKey struct{}
+
+// requestLimiter passes rate limiter of request to HttpTransport, so every retry attempt
+// takes permission from limiter and every throttled attempt is reported
+type requestLimiter struct {
+	limiter *RateLimiter
+	// set when transport reported result of attempt
+	reported int32
+}
+
+func withRequestLimiter(ctx context.Context, limiter *RateLimiter) (context.Context, *requestLimiter) {
+	rl := &requestLimiter{limiter: limiter}
+	return context.WithValue(ctx, requestLimiterKey{}, rl), rl
+}
+
+func requestLimiterFrom(ctx context.Context) *requestLimiter {
+	rl, _ := ctx.Value(requestLimiterKey{}).(*requestLimiter)
+	return rl
+}
+
+// report adapts rate to response status of attempt
+func (rl *requestLimiter) report(status int) {
+	atomic.StoreInt32(&rl.reported, 1)
+
+	if status == http.StatusTooManyRequests {
+		rl.limiter.ReportThrottled()
+	} else if status == http.StatusOK {
+		rl.limiter.ReportSuccess()
+	}
+}
+
+// wasReported reports whether transport reported attempts itself
+func (rl *requestLimiter) wasReported() bool {
+	return atomic.LoadInt32(&rl.reported) == 1
+}
@@ -0,0 +1,89 @@
+package hms
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+)
+
+// throttlingServer responds with 429 to first throttled requests and with success to the rest
+func throttlingServer(throttled int32, requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(requests, 1) <= throttled {
+			w.WriteHeader(http.StatusTooManyRequests)
+			w.Write([]byte(`{"code":"80300008"}`))
+			return
+		}
+		w.Write([]byte(`{"code":"80000000"}`))
+	}))
+}
+
+func TestRateLimiterAdaptsToThrottledRetry(t *testing.T) {
+	var requests int32
+	server := throttlingServer(1, &requests)
+	defer server.Close()
+
+	limiter, err := NewRateLimiter(100, 10, RateLimitWait)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewHuaweiClient("app", "secret",
+		WithBaseURL(server.URL),
+		WithTokenSource(&countingTokenSource{}),
+		WithRetryPolicy(3, NewConstantBackoff(0)),
+		WithPushRateLimiter(limiter),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := client.SendMessage(context.Background(), GetDefaultAndroidNotificationMessage([]string{"device"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Code != SuccessCode {
+		t.Fatalf("code = %s, want %s", resp.Code, SuccessCode)
+	}
+
+	if requests != 2 {
+		t.Fatalf("server received %d requests, want 2", requests)
+	}
+
+	// halved by throttled attempt and partially restored by successful retry
+	if rate := limiter.Rate(); rate != 55 {
+		t.Fatalf("rate = %v, want 55", rate)
+	}
+}
+
+func TestRateLimiterLimitsRetries(t *testing.T) {
+	var requests int32
+	server := throttlingServer(1, &requests)
+	defer server.Close()
+
+	limiter, err := NewRateLimiter(0.01, 1, RateLimitReject)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewHuaweiClient("app", "secret",
+		WithBaseURL(server.URL),
+		WithTokenSource(&countingTokenSource{}),
+		WithRetryPolicy(3, NewConstantBackoff(0)),
+		WithPushRateLimiter(limiter),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = client.SendMessage(context.Background(), GetDefaultAndroidNotificationMessage([]string{"device"}))
+	if err != ErrRateLimited {
+		t.Fatalf("error = %v, want %v", err, ErrRateLimited)
+	}
+
+	if requests != 1 {
+		t.Fatalf("server received %d requests, want 1", requests)
+	}
+}
@@ -0,0 +1,383 @@
+package hms
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// Interaction is request sent through recording transport and response to it
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+// RecordedRequest is request with redacted credentials
+type RecordedRequest struct {
+	Method  string            `json:"method"`
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Body    string            `json:"body,omitempty"`
+}
+
+// RecordedResponse is response with redacted credentials. Error is set if request failed without response
+type RecordedResponse struct {
+	Status int         `json:"status,omitempty"`
+	Header http.Header `json:"header,omitempty"`
+	Body   string      `json:"body,omitempty"`
+	Error  string      `json:"error,omitempty"`
+}
+
+// RecordingTransport sends requests with wrapped transport and records them with responses.
+// Credentials are redacted, so fixture file can be committed. Call Save to write fixture file.
+// Retries of wrapped HttpTransport aren't visible to it, use RecordingRoundTripper to record every attempt
+type RecordingTransport struct {
+	*recorder
+	next Transporter
+}
+
+// NewRecordingTransport creates transport recording interactions of next transport to fixture file at path
+func NewRecordingTransport(next Transporter, path string) (*RecordingTransport, error) {
+	if next == nil {
+		return nil, errors.New("passed empty transport")
+	}
+
+	rec, err := newRecorder(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RecordingTransport{recorder: rec, next: next}, nil
+}
+
+func (t *RecordingTransport) Send(ctx context.Context, req *HttpRequest) (*HttpResponse, error) {
+	interaction := Interaction{Request: recordRequest(req)}
+
+	resp, err := t.next.Send(ctx, req)
+	if err != nil {
+		interaction.Response.Error = err.Error()
+		t.record(interaction)
+		return resp, err
+	}
+
+	// body is read to be recorded, caller gets its copy
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+
+	interaction.Response = recordResponse(resp.Status, resp.Header, data)
+	t.record(interaction)
+
+	return resp, nil
+}
+
+// RecordingRoundTripper records every http request attempt with its response. It's used as transport
+// of http client passed with TransportHTTPClient, so retries of HttpTransport are recorded too.
+// Credentials are redacted, so fixture file can be committed. Call Save to write fixture file
+type RecordingRoundTripper struct {
+	*recorder
+	next http.RoundTripper
+}
+
+// NewRecordingRoundTripper creates round tripper recording interactions of next round tripper to fixture file at path
+func NewRecordingRoundTripper(next http.RoundTripper, path string) (*RecordingRoundTripper, error) {
+	if next == nil {
+		return nil, errors.New("passed empty round tripper")
+	}
+
+	rec, err := newRecorder(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RecordingRoundTripper{recorder: rec, next: next}, nil
+}
+
+func (t *RecordingRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	request := &HttpRequest{Method: req.Method, URL: req.URL.String(), Headers: make(map[string]string)}
+	for header := range req.Header {
+		request.Headers[header] = req.Header.Get(header)
+	}
+
+	if req.Body != nil {
+		body, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		request.Body = body
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	interaction := Interaction{Request: recordRequest(request)}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		interaction.Response.Error = err.Error()
+		t.record(interaction)
+		return resp, err
+	}
+
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+
+	interaction.Response = recordResponse(resp.StatusCode, resp.Header, data)
+	t.record(interaction)
+
+	return resp, nil
+}
+
+// recorder keeps recorded interactions and writes them to fixture file
+type recorder struct {
+	path string
+
+	mu           sync.Mutex
+	interactions []Interaction
+}
+
+func newRecorder(path string) (*recorder, error) {
+	if path == "" {
+		return nil, errors.New("path can't be empty")
+	}
+
+	return &recorder{path: path}, nil
+}
+
+// Interactions returns interactions recorded so far
+func (r *recorder) Interactions() []Interaction {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return append([]Interaction(nil), r.interactions...)
+}
+
+// Save writes recorded interactions to fixture file
+func (r *recorder) Save() error {
+	data, err := json.MarshalIndent(r.Interactions(), "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(r.path, data, 0644)
+}
+
+func (r *recorder) record(interaction Interaction) {
+	r.mu.Lock()
+	r.interactions = append(r.interactions, interaction)
+	r.mu.Unlock()
+}
+
+func recordRequest(req *HttpRequest) RecordedRequest {
+	return RecordedRequest{
+		Method:  req.Method,
+		URL:     req.URL,
+		Headers: redactHeaders(req.Headers),
+		Body:    redactBody(req),
+	}
+}
+
+func recordResponse(status int, header http.Header, body []byte) RecordedResponse {
+	return RecordedResponse{
+		Status: status,
+		Header: redactHTTPHeader(header),
+		Body:   redactAccessToken(body),
+	}
+}
+
+// redactHTTPHeader returns copy of header with credentials replaced
+func redactHTTPHeader(header http.Header) http.Header {
+	if header == nil {
+		return nil
+	}
+
+	result := make(http.Header, len(header))
+	for name, values := range header {
+		if isSensitiveHeader(name) {
+			values = []string{redacted}
+		}
+		result[name] = append([]string(nil), values...)
+	}
+	return result
+}
+
+// redactAccessToken replaces access token in oauth server response
+func redactAccessToken(body []byte) string {
+	var msg map[string]interface{}
+	if err := json.Unmarshal(body, &msg); err != nil {
+		return string(body)
+	}
+
+	if _, ok := msg["access_token"]; !ok {
+		return string(body)
+	}
+	msg["access_token"] = redacted
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return redacted
+	}
+	return string(data)
+}
+
+// ReplayTransport serves responses recorded by RecordingTransport without network.
+// Every request is answered with the first unused interaction having the same method and URL
+type ReplayTransport struct {
+	*replayer
+}
+
+// NewReplayTransport loads interactions from fixture file
+func NewReplayTransport(path string) (*ReplayTransport, error) {
+	interactions, err := loadInteractions(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewReplayTransportFromInteractions(interactions), nil
+}
+
+// NewReplayTransportFromInteractions creates replay transport serving provided interactions
+func NewReplayTransportFromInteractions(interactions []Interaction) *ReplayTransport {
+	return &ReplayTransport{replayer: newReplayer(interactions)}
+}
+
+func (t *ReplayTransport) Send(ctx context.Context, req *HttpRequest) (*HttpResponse, error) {
+	interaction, err := t.next(req.Method, req.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &HttpResponse{
+		Status: interaction.Response.Status,
+		Header: replayHeader(interaction),
+		Body:   ioutil.NopCloser(strings.NewReader(interaction.Response.Body)),
+	}, nil
+}
+
+// ReplayRoundTripper serves responses recorded by RecordingRoundTripper without network. It's used as transport
+// of http client passed with TransportHTTPClient, so every attempt of HttpTransport including retries is replayed.
+// Every request is answered with the first unused interaction having the same method and URL
+type ReplayRoundTripper struct {
+	*replayer
+}
+
+// NewReplayRoundTripper loads interactions from fixture file
+func NewReplayRoundTripper(path string) (*ReplayRoundTripper, error) {
+	interactions, err := loadInteractions(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewReplayRoundTripperFromInteractions(interactions), nil
+}
+
+// NewReplayRoundTripperFromInteractions creates replay round tripper serving provided interactions
+func NewReplayRoundTripperFromInteractions(interactions []Interaction) *ReplayRoundTripper {
+	return &ReplayRoundTripper{replayer: newReplayer(interactions)}
+}
+
+func (t *ReplayRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		req.Body.Close()
+	}
+
+	interaction, err := t.next(req.Method, req.URL.String())
+	if err != nil {
+		return nil, err
+	}
+
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", interaction.Response.Status, http.StatusText(interaction.Response.Status)),
+		StatusCode:    interaction.Response.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        replayHeader(interaction),
+		Body:          ioutil.NopCloser(strings.NewReader(interaction.Response.Body)),
+		ContentLength: int64(len(interaction.Response.Body)),
+		Request:       req,
+	}, nil
+}
+
+// replayer serves recorded interactions in order
+type replayer struct {
+	mu           sync.Mutex
+	interactions []Interaction
+	used         []bool
+}
+
+func newReplayer(interactions []Interaction) *replayer {
+	return &replayer{
+		interactions: interactions,
+		used:         make([]bool, len(interactions)),
+	}
+}
+
+// next marks first unused interaction with the same method and URL as used and returns it.
+// Error is returned if there is no such interaction or it recorded failed request
+func (r *replayer) next(method, url string) (*Interaction, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i := range r.interactions {
+		interaction := &r.interactions[i]
+		if r.used[i] || interaction.Request.Method != method || interaction.Request.URL != url {
+			continue
+		}
+		r.used[i] = true
+
+		if interaction.Response.Error != "" {
+			return nil, errors.New(interaction.Response.Error)
+		}
+		return interaction, nil
+	}
+
+	return nil, fmt.Errorf("no recorded interaction for %s %s", method, url)
+}
+
+// Remaining returns number of interactions which weren't served yet
+func (r *replayer) Remaining() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	remaining := 0
+	for _, used := range r.used {
+		if !used {
+			remaining++
+		}
+	}
+	return remaining
+}
+
+func replayHeader(interaction *Interaction) http.Header {
+	if interaction.Response.Header == nil {
+		return make(http.Header)
+	}
+	return interaction.Response.Header.Clone()
+}
+
+func loadInteractions(path string) ([]Interaction, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var interactions []Interaction
+	if err := json.Unmarshal(data, &interactions); err != nil {
+		return nil, err
+	}
+
+	return interactions, nil
+}
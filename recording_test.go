@@ -0,0 +1,140 @@
+package hms
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// recordedServer issues token with cookie and fails first push request with server error
+func recordedServer(pushes *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == authPath {
+			http.SetCookie(w, &http.Cookie{Name: "session", Value: "secret-cookie"})
+			w.Write([]byte(`{"access_token":"secret-access-token","expires_in":3600}`))
+			return
+		}
+
+		if atomic.AddInt32(pushes, 1) == 1 {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{"code":"80000000","requestId":"recorded"}`))
+	}))
+}
+
+func sendWithRoundTripper(t *testing.T, baseURL string, rt http.RoundTripper) (*HuaweiResponse, int32) {
+	t.Helper()
+
+	var retries int32
+	client, err := NewHuaweiClient("app", "app-secret",
+		WithBaseURL(baseURL),
+		WithTransportOptions(
+			TransportHTTPClient(&http.Client{Transport: rt}),
+			TransportBackoff(NewConstantBackoff(0)),
+			TransportRetryHook(func(ctx context.Context, info RetryInfo) {
+				atomic.AddInt32(&retries, 1)
+			}),
+		),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := client.SendMessage(context.Background(), GetDefaultAndroidNotificationMessage([]string{"device"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp, atomic.LoadInt32(&retries)
+}
+
+func TestRecordAndReplayRoundTripper(t *testing.T) {
+	var pushes int32
+	server := recordedServer(&pushes)
+	fixture := filepath.Join(tempDir(t), "fixture.json")
+
+	recorder, err := NewRecordingRoundTripper(http.DefaultTransport, fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, retries := sendWithRoundTripper(t, server.URL, recorder)
+	server.Close()
+	if resp.RequestId != "recorded" || retries != 1 {
+		t.Fatalf("recorded response = %+v with %d retries, want success after 1 retry", resp, retries)
+	}
+
+	if err := recorder.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := ioutil.ReadFile(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"app-secret", "secret-access-token", "secret-cookie"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("fixture contains %q", secret)
+		}
+	}
+
+	// token request and both attempts of push request
+	if n := len(recorder.Interactions()); n != 3 {
+		t.Fatalf("recorded %d interactions, want 3", n)
+	}
+
+	replay, err := NewReplayRoundTripper(fixture)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, retries = sendWithRoundTripper(t, server.URL, replay)
+	if resp.RequestId != "recorded" || retries != 1 {
+		t.Fatalf("replayed response = %+v with %d retries, want success after 1 retry", resp, retries)
+	}
+
+	if remaining := replay.Remaining(); remaining != 0 {
+		t.Fatalf("%d interactions weren't replayed", remaining)
+	}
+}
+
+func TestRecordingTransportRedactsResponseHeaders(t *testing.T) {
+	var pushes int32
+	server := recordedServer(&pushes)
+	defer server.Close()
+
+	transport, err := NewTransport()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder, err := NewRecordingTransport(transport, filepath.Join(tempDir(t), "fixture.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := NewHTTPRequest().SetMethod(http.MethodPost).SetURL(server.URL + authPath)
+	resp, err := recorder.Send(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	interaction := recorder.Interactions()[0]
+	if cookie := interaction.Response.Header.Get("Set-Cookie"); cookie != redacted {
+		t.Fatalf("recorded Set-Cookie = %q, want redacted", cookie)
+	}
+	if strings.Contains(interaction.Response.Body, "secret-access-token") {
+		t.Fatal("recorded body contains access token")
+	}
+
+	// caller still gets original response
+	if resp.Header.Get("Set-Cookie") == redacted {
+		t.Fatal("response header of caller was redacted")
+	}
+}
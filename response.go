@@ -1,5 +1,10 @@
 package hms
 
+import (
+	"encoding/json"
+	"fmt"
+)
+
 type ResponseCode string
 
 const (
@@ -61,4 +66,94 @@ type HuaweiResponse struct {
 
 	// Request ID.
 	RequestId string `json:"requestId"`
+
+	// Parsed result of partially successful request.
+	// Set only when Code is SomeTokenSuccessErrorCode
+	Partial *PartialResult `json:"-"`
+}
+
+// PartialResult represents result description sent in msg field of partially successful request
+type PartialResult struct {
+	// Number of tokens message was sent to.
+	SuccessCount int `json:"success"`
+
+	// Number of tokens message failed to be sent to.
+	FailureCount int `json:"failure"`
+
+	// Tokens message failed to be sent to.
+	IllegalTokens []string `json:"illegal_tokens"`
+}
+
+func (r *HuaweiResponse) UnmarshalJSON(data []byte) error {
+	// alias type prevents recursive call of UnmarshalJSON
+	type response HuaweiResponse
+
+	var resp response
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return err
+	}
+	*r = HuaweiResponse(resp)
+
+	if r.Code == SomeTokenSuccessErrorCode {
+		var partial PartialResult
+		// msg is kept as is if push server changes its format
+		if err := json.Unmarshal([]byte(r.Msg), &partial); err == nil {
+			r.Partial = &partial
+		}
+	}
+
+	return nil
+}
+
+// Err returns *HMSError if response code is not success, otherwise nil
+func (r *HuaweiResponse) Err() error {
+	if r.Code == SuccessCode {
+		return nil
+	}
+
+	return &HMSError{
+		Code:      r.Code,
+		Msg:       r.Msg,
+		RequestId: r.RequestId,
+	}
+}
+
+// HMSError represents non-success result code returned by push server
+type HMSError struct {
+	// Result code.
+	Code ResponseCode
+
+	// Result code description.
+	Msg string
+
+	// Request ID.
+	RequestId string
+}
+
+func (e *HMSError) Error() string {
+	return fmt.Sprintf("push server responded with code %s: %s (request id %s)", e.Code, e.Msg, e.RequestId)
+}
+
+// IsRetryable reports whether the same request may succeed if it is sent again later
+func (e *HMSError) IsRetryable() bool {
+	return e.Code == InternalErrorCode
+}
+
+// IsAuth reports whether request failed because of authentication or missing permissions
+func (e *HMSError) IsAuth() bool {
+	switch e.Code {
+	case TokenFailedErrorCode, TokenTimeoutErrorCode, NoPushPermissionErrorCode, NotAuthForHighPriorityMsgErrorCode:
+		return true
+	}
+	return false
+}
+
+// IsInvalidToken reports whether some or all device tokens of request are invalid
+func (e *HMSError) IsInvalidToken() bool {
+	return e.Code == AllTokenInvalidErrorCode || e.Code == SomeTokenSuccessErrorCode
+}
+
+// IsQuota reports whether request exceeds push server limits on body size or number of tokens
+func (e *HMSError) IsQuota() bool {
+	return e.Code == BodyToBigErrorCode || e.Code == TokensToMuchErrorCode
 }
@@ -0,0 +1,53 @@
+package hms
+
+import "testing"
+
+func TestHMSErrorClassification(t *testing.T) {
+	tests := []struct {
+		code                                 ResponseCode
+		retryable, auth, invalidToken, quota bool
+	}{
+		{InternalErrorCode, true, false, false, false},
+		{TokenFailedErrorCode, false, true, false, false},
+		{TokenTimeoutErrorCode, false, true, false, false},
+		{NoPushPermissionErrorCode, false, true, false, false},
+		{NotAuthForHighPriorityMsgErrorCode, false, true, false, false},
+		{AllTokenInvalidErrorCode, false, false, true, false},
+		{SomeTokenSuccessErrorCode, false, false, true, false},
+		{BodyToBigErrorCode, false, false, false, true},
+		{TokensToMuchErrorCode, false, false, false, true},
+		{ParameterErrorCode, false, false, false, false},
+		{IncorrectMessageErrorCode, false, false, false, false},
+	}
+
+	for _, tt := range tests {
+		err := &HMSError{Code: tt.code}
+		if err.IsRetryable() != tt.retryable {
+			t.Errorf("%s: IsRetryable = %v, want %v", tt.code, err.IsRetryable(), tt.retryable)
+		}
+		if err.IsAuth() != tt.auth {
+			t.Errorf("%s: IsAuth = %v, want %v", tt.code, err.IsAuth(), tt.auth)
+		}
+		if err.IsInvalidToken() != tt.invalidToken {
+			t.Errorf("%s: IsInvalidToken = %v, want %v", tt.code, err.IsInvalidToken(), tt.invalidToken)
+		}
+		if err.IsQuota() != tt.quota {
+			t.Errorf("%s: IsQuota = %v, want %v", tt.code, err.IsQuota(), tt.quota)
+		}
+	}
+}
+
+func TestHuaweiResponseErr(t *testing.T) {
+	if err := (&HuaweiResponse{Code: SuccessCode}).Err(); err != nil {
+		t.Fatalf("Err = %v, want nil for success", err)
+	}
+
+	resp := &HuaweiResponse{Code: ParameterErrorCode, Msg: "bad parameter", RequestId: "request"}
+	err, ok := resp.Err().(*HMSError)
+	if !ok {
+		t.Fatalf("Err = %T, want *HMSError", resp.Err())
+	}
+	if *err != (HMSError{Code: ParameterErrorCode, Msg: "bad parameter", RequestId: "request"}) {
+		t.Fatalf("Err = %+v", err)
+	}
+}
@@ -0,0 +1,180 @@
+package hms
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TokenMsg represents response of huawei oauth server
+type TokenMsg struct {
+	AccessToken      string `json:"access_token"`
+	ExpiresIn        int    `json:"expires_in"`
+	Scope            string `json:"scope"`
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// AuthError is returned when huawei oauth server refuses to issue access token
+type AuthError struct {
+	// HTTP status code of oauth server response
+	StatusCode int
+
+	// OAuth error code from error field of response
+	Code string
+
+	// OAuth error description from error_description field of response
+	Description string
+
+	// Permanent indicates that request will fail again without changing credentials,
+	// for example because of wrong app secret. Otherwise failure is transient and request may be retried
+	Permanent bool
+}
+
+func (e *AuthError) Error() string {
+	msg := fmt.Sprintf("oauth server responded with status %d", e.StatusCode)
+	if e.Code != "" {
+		msg += ", error " + e.Code
+	}
+
+	if e.Description != "" {
+		msg += ": " + e.Description
+	}
+	return msg
+}
+
+// IsPermanent reports whether request will fail again without changing credentials
+func (e *AuthError) IsPermanent() bool {
+	return e.Permanent
+}
+
+// newAuthError builds auth error from oauth server response
+func newAuthError(status int, body io.Reader) *AuthError {
+	authErr := &AuthError{
+		StatusCode: status,
+		Permanent:  isPermanentAuthStatus(status),
+	}
+
+	data, err := ioutil.ReadAll(io.LimitReader(body, respReadLimit))
+	if err != nil {
+		return authErr
+	}
+
+	// huawei returns numeric error codes, while standard oauth servers return strings
+	var msg struct {
+		Error            json.RawMessage `json:"error"`
+		ErrorDescription string          `json:"error_description"`
+	}
+	if err := json.Unmarshal(data, &msg); err != nil {
+		authErr.Description = strings.TrimSpace(string(data))
+		return authErr
+	}
+
+	authErr.Code = strings.Trim(string(msg.Error), `"`)
+	authErr.Description = msg.ErrorDescription
+	authErr.Permanent = authErr.Permanent || isPermanentAuthCode(authErr.Code)
+
+	return authErr
+}
+
+// isPermanentAuthCode reports whether oauth error code means credentials or request are wrong
+func isPermanentAuthCode(code string) bool {
+	switch code {
+	case "invalid_client", "invalid_grant", "unauthorized_client", "unsupported_grant_type", "invalid_scope":
+		return true
+	}
+	return false
+}
+
+// isPermanentAuthStatus reports whether oauth server status means credentials or request are wrong
+func isPermanentAuthStatus(status int) bool {
+	switch status {
+	case http.StatusBadRequest, http.StatusUnauthorized, http.StatusForbidden:
+		return true
+	}
+	return false
+}
+
+// Token represents access token used to authorize push api requests
+type Token struct {
+	// Access token value sent in Authorization header
+	AccessToken string `json:"access_token"`
+
+	// Moment when token expires. Zero value means token expiration is unknown
+	Expiry time.Time `json:"expiry,omitempty"`
+
+	// Moment when token was issued. Client sets it to time of receiving token if it's zero
+	IssuedAt time.Time `json:"issued_at,omitempty"`
+}
+
+// isExpired reports whether token has already expired
+func (t *Token) isExpired() bool {
+	return !t.Expiry.IsZero() && !time.Now().Before(t.Expiry)
+}
+
+// TokenSource supplies access tokens for HuaweiClient.
+// Token is called only when client has no valid token,
+// so implementations don't need to cache tokens themselves
+type TokenSource interface {
+	Token(ctx context.Context) (*Token, error)
+}
+
+// clientCredentialsTokenSource requests tokens from huawei oauth server with client credentials flow
+type clientCredentialsTokenSource struct {
+	appId     string
+	appSecret string
+	authURL   string
+	transport Transporter
+}
+
+func (s *clientCredentialsTokenSource) Token(ctx context.Context) (*Token, error) {
+	u, err := url.Parse(s.appSecret)
+	if err != nil {
+		return nil, err
+	}
+	body := fmt.Sprintf("grant_type=client_credentials&client_secret=%s&client_id=%s", u.String(), s.appId)
+
+	request := NewHTTPRequest().
+		SetMethod(http.MethodPost).
+		SetURL(s.authURL).
+		SetStringBody(body).
+		SetHeader("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.transport.Send(ctx, request)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.Status != http.StatusOK {
+		return nil, newAuthError(resp.Status, resp.Body)
+	}
+
+	var msg TokenMsg
+	if err := json.NewDecoder(resp.Body).Decode(&msg); err != nil {
+		return nil, err
+	}
+
+	if msg.Error != "" {
+		return nil, &AuthError{
+			StatusCode:  resp.Status,
+			Code:        msg.Error,
+			Description: msg.ErrorDescription,
+			Permanent:   isPermanentAuthCode(msg.Error),
+		}
+	}
+
+	token := &Token{AccessToken: msg.AccessToken, IssuedAt: time.Now()}
+	if msg.ExpiresIn > 0 {
+		token.Expiry = token.IssuedAt.Add(time.Duration(msg.ExpiresIn) * time.Second)
+	}
+
+	return token, nil
+}
@@ -0,0 +1,253 @@
+package hms
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+)
+
+const (
+	// how often file token store checks whether lock was released
+	fileLockPollInterval = 50 * time.Millisecond
+
+	// DefaultFileLockTTL is age after which file lock is treated as abandoned by crashed process
+	DefaultFileLockTTL = time.Minute
+)
+
+var (
+	fileKeyPattern = regexp.MustCompile(`[^a-zA-Z0-9_.-]`)
+)
+
+// TokenStore keeps access tokens shared between multiple clients or processes
+type TokenStore interface {
+	// Get returns token stored under key. Nil token without error means there is no token
+	Get(ctx context.Context, key string) (*Token, error)
+
+	// Set stores token under key until token expiry
+	Set(ctx context.Context, key string, token *Token) error
+
+	// Lock acquires exclusive lock on key, so only one holder requests new token.
+	// Returned function releases lock
+	Lock(ctx context.Context, key string) (func(), error)
+}
+
+// MemoryTokenStore keeps tokens in memory. It shares token between clients of the same process
+type MemoryTokenStore struct {
+	mu     sync.Mutex
+	tokens map[string]Token
+	locks  map[string]chan struct{}
+}
+
+func NewMemoryTokenStore() *MemoryTokenStore {
+	return &MemoryTokenStore{
+		tokens: make(map[string]Token),
+		locks:  make(map[string]chan struct{}),
+	}
+}
+
+func (s *MemoryTokenStore) Get(ctx context.Context, key string) (*Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token, ok := s.tokens[key]
+	if !ok {
+		return nil, nil
+	}
+
+	if token.isExpired() {
+		delete(s.tokens, key)
+		return nil, nil
+	}
+
+	return &token, nil
+}
+
+func (s *MemoryTokenStore) Set(ctx context.Context, key string, token *Token) error {
+	if token == nil {
+		return errors.New("passed empty token")
+	}
+
+	s.mu.Lock()
+	s.tokens[key] = *token
+	s.mu.Unlock()
+
+	return nil
+}
+
+func (s *MemoryTokenStore) Lock(ctx context.Context, key string) (func(), error) {
+	s.mu.Lock()
+	lock, ok := s.locks[key]
+	if !ok {
+		lock = make(chan struct{}, 1)
+		s.locks[key] = lock
+	}
+	s.mu.Unlock()
+
+	select {
+	case lock <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	return func() { <-lock }, nil
+}
+
+// FileTokenStore keeps tokens in files of a directory. It shares token between processes of the same host
+// or hosts with shared volume. Every key is stored in its own file, lock is represented by separate lock file
+type FileTokenStore struct {
+	dir     string
+	lockTTL time.Duration
+}
+
+// NewFileTokenStore creates file token store in dir. Directory is created if it doesn't exist
+func NewFileTokenStore(dir string) (*FileTokenStore, error) {
+	if dir == "" {
+		return nil, errors.New("dir can't be empty")
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+
+	return &FileTokenStore{
+		dir:     dir,
+		lockTTL: DefaultFileLockTTL,
+	}, nil
+}
+
+// SetLockTTL sets age after which lock file is treated as abandoned and removed
+func (s *FileTokenStore) SetLockTTL(ttl time.Duration) error {
+	if ttl <= 0 {
+		return errors.New("lock ttl must be positive")
+	}
+	s.lockTTL = ttl
+
+	return nil
+}
+
+func (s *FileTokenStore) Get(ctx context.Context, key string) (*Token, error) {
+	data, err := ioutil.ReadFile(s.path(key, ".json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var token Token
+	if err := json.Unmarshal(data, &token); err != nil {
+		return nil, err
+	}
+
+	if token.isExpired() {
+		return nil, nil
+	}
+
+	return &token, nil
+}
+
+func (s *FileTokenStore) Set(ctx context.Context, key string, token *Token) error {
+	if token == nil {
+		return errors.New("passed empty token")
+	}
+
+	data, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+
+	// write to temporary file and rename it, so readers never see partially written token
+	tmp, err := ioutil.TempFile(s.dir, ".token-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), s.path(key, ".json"))
+}
+
+func (s *FileTokenStore) Lock(ctx context.Context, key string) (func(), error) {
+	lockPath := s.path(key, ".lock")
+
+	for {
+		f, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			info, err := f.Stat()
+			f.Close()
+			if err != nil {
+				os.Remove(lockPath)
+				return nil, err
+			}
+
+			return func() {
+				// lock could be broken as stale and taken by another waiter if holder exceeded lock ttl
+				if current, err := os.Stat(lockPath); err == nil && os.SameFile(info, current) {
+					os.Remove(lockPath)
+				}
+			}, nil
+		}
+
+		if !os.IsExist(err) {
+			return nil, err
+		}
+
+		// lock owner probably crashed without releasing lock
+		if s.isStale(lockPath) && s.breakStaleLock(lockPath) {
+			continue
+		}
+
+		select {
+		case <-time.After(fileLockPollInterval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// breakStaleLock removes stale lock file. Waiters break lock one at a time holding break file,
+// so lock taken by another waiter right after stale one was removed is never removed.
+// It reports whether lock was checked by this waiter
+func (s *FileTokenStore) breakStaleLock(lockPath string) bool {
+	breakPath := lockPath + ".break"
+
+	f, err := os.OpenFile(breakPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		// break file left by waiter which crashed while breaking lock
+		if os.IsExist(err) && s.isStale(breakPath) {
+			os.Remove(breakPath)
+		}
+		return false
+	}
+	f.Close()
+	defer os.Remove(breakPath)
+
+	// lock could be already broken and taken by another waiter after it was checked
+	if s.isStale(lockPath) {
+		os.Remove(lockPath)
+	}
+	return true
+}
+
+func (s *FileTokenStore) isStale(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && time.Since(info.ModTime()) > s.lockTTL
+}
+
+func (s *FileTokenStore) path(key, ext string) string {
+	return filepath.Join(s.dir, fileKeyPattern.ReplaceAllString(key, "_")+ext)
+}
@@ -0,0 +1,310 @@
+package hms
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func testTokenStore(t *testing.T, store TokenStore) {
+	ctx := context.Background()
+
+	t.Run("missing", func(t *testing.T) {
+		token, err := store.Get(ctx, "missing")
+		if err != nil || token != nil {
+			t.Fatalf("Get = %v, %v, want nil, nil", token, err)
+		}
+	})
+
+	t.Run("set and get", func(t *testing.T) {
+		expiry := time.Now().Add(time.Hour).Round(time.Second)
+		if err := store.Set(ctx, "app", &Token{AccessToken: "token", Expiry: expiry}); err != nil {
+			t.Fatal(err)
+		}
+
+		token, err := store.Get(ctx, "app")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token == nil || token.AccessToken != "token" || !token.Expiry.Equal(expiry) {
+			t.Fatalf("Get = %+v, want token expiring at %s", token, expiry)
+		}
+	})
+
+	t.Run("expired", func(t *testing.T) {
+		if err := store.Set(ctx, "expired", &Token{AccessToken: "token", Expiry: time.Now().Add(-time.Second)}); err != nil {
+			t.Fatal(err)
+		}
+
+		token, err := store.Get(ctx, "expired")
+		if err != nil || token != nil {
+			t.Fatalf("Get = %v, %v, want nil, nil", token, err)
+		}
+	})
+
+	t.Run("set empty", func(t *testing.T) {
+		if err := store.Set(ctx, "app", nil); err == nil {
+			t.Fatal("expected error for empty token")
+		}
+	})
+
+	t.Run("lock is exclusive", func(t *testing.T) {
+		var holders, maxHolders int32
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+
+				unlock, err := store.Lock(ctx, "lock")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				defer unlock()
+
+				n := atomic.AddInt32(&holders, 1)
+				for {
+					max := atomic.LoadInt32(&maxHolders)
+					if n <= max || atomic.CompareAndSwapInt32(&maxHolders, max, n) {
+						break
+					}
+				}
+				time.Sleep(time.Millisecond)
+				atomic.AddInt32(&holders, -1)
+			}()
+		}
+		wg.Wait()
+
+		if maxHolders != 1 {
+			t.Fatalf("lock was held by %d holders at once", maxHolders)
+		}
+	})
+
+	t.Run("lock context", func(t *testing.T) {
+		unlock, err := store.Lock(ctx, "busy")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer unlock()
+
+		lockCtx, cancel := context.WithTimeout(ctx, 100*time.Millisecond)
+		defer cancel()
+		if _, err := store.Lock(lockCtx, "busy"); err != context.DeadlineExceeded {
+			t.Fatalf("Lock error = %v, want %v", err, context.DeadlineExceeded)
+		}
+	})
+}
+
+func TestMemoryTokenStore(t *testing.T) {
+	testTokenStore(t, NewMemoryTokenStore())
+}
+
+// tempDir creates directory removed after test
+func tempDir(t *testing.T) string {
+	t.Helper()
+
+	dir, err := ioutil.TempDir("", "hms-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+
+	return dir
+}
+
+func TestFileTokenStore(t *testing.T) {
+	store, err := NewFileTokenStore(tempDir(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testTokenStore(t, store)
+}
+
+func TestFileTokenStoreSharedBetweenInstances(t *testing.T) {
+	dir := tempDir(t)
+	ctx := context.Background()
+
+	first, err := NewFileTokenStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := NewFileTokenStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := first.Set(ctx, "app/id", &Token{AccessToken: "shared", Expiry: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := second.Get(ctx, "app/id")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token == nil || token.AccessToken != "shared" {
+		t.Fatalf("Get = %+v, want shared token", token)
+	}
+}
+
+func TestFileTokenStoreBreaksStaleLockOnce(t *testing.T) {
+	dir := tempDir(t)
+	ctx := context.Background()
+
+	store, err := NewFileTokenStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// lock abandoned by crashed process
+	lockPath := store.path("app", ".lock")
+	if err := ioutil.WriteFile(lockPath, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	old := time.Now().Add(-2 * DefaultFileLockTTL)
+	if err := os.Chtimes(lockPath, old, old); err != nil {
+		t.Fatal(err)
+	}
+
+	var holders, maxHolders, acquired int32
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			unlock, err := store.Lock(ctx, "app")
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			defer unlock()
+
+			atomic.AddInt32(&acquired, 1)
+			n := atomic.AddInt32(&holders, 1)
+			for {
+				max := atomic.LoadInt32(&maxHolders)
+				if n <= max || atomic.CompareAndSwapInt32(&maxHolders, max, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			atomic.AddInt32(&holders, -1)
+		}()
+	}
+	wg.Wait()
+
+	if acquired != 20 {
+		t.Fatalf("lock was acquired %d times, want 20", acquired)
+	}
+	if maxHolders != 1 {
+		t.Fatalf("lock was held by %d holders at once", maxHolders)
+	}
+}
+
+// countingTokenSource issues new token on every call
+type countingTokenSource struct {
+	calls int32
+}
+
+func (s *countingTokenSource) Token(ctx context.Context) (*Token, error) {
+	n := atomic.AddInt32(&s.calls, 1)
+	return &Token{AccessToken: fmt.Sprintf("token-%d", n), Expiry: time.Now().Add(time.Hour)}, nil
+}
+
+// successTransport answers every push request with success and records its authorization header
+func successTransport(authorizations *[]string, mu *sync.Mutex) Transporter {
+	return TransporterFunc(func(ctx context.Context, req *HttpRequest) (*HttpResponse, error) {
+		mu.Lock()
+		*authorizations = append(*authorizations, req.Headers["Authorization"])
+		mu.Unlock()
+
+		return &HttpResponse{
+			Status: http.StatusOK,
+			Header: make(http.Header),
+			Body:   ioutil.NopCloser(strings.NewReader(`{"code":"80000000"}`)),
+		}, nil
+	})
+}
+
+func TestClientSharesTokenThroughStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryTokenStore()
+	source := &countingTokenSource{}
+
+	var (
+		mu             sync.Mutex
+		authorizations []string
+	)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		client, err := NewHuaweiClient("app", "secret",
+			WithTransport(successTransport(&authorizations, &mu)),
+			WithTokenSource(source),
+			WithTokenStore(store),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.SendMessage(ctx, GetDefaultAndroidNotificationMessage([]string{"device"})); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if calls := atomic.LoadInt32(&source.calls); calls != 1 {
+		t.Fatalf("token source was called %d times, want 1", calls)
+	}
+
+	for _, authorization := range authorizations {
+		if authorization != "Bearer token-1" {
+			t.Fatalf("authorization = %q, want token shared through store", authorization)
+		}
+	}
+}
+
+func TestClientSkipsStaleStoredToken(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryTokenStore()
+	source := &countingTokenSource{}
+
+	if err := store.Set(ctx, "app", &Token{AccessToken: "rejected", Expiry: time.Now().Add(time.Hour)}); err != nil {
+		t.Fatal(err)
+	}
+
+	client, err := NewHuaweiClient("app", "secret", WithTokenSource(source), WithTokenStore(store))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// push server rejected stored token, so it must not be taken from store again
+	token, err := client.refreshToken(ctx, "rejected")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token != "token-1" {
+		t.Fatalf("token = %q, want token from source", token)
+	}
+
+	stored, err := store.Get(ctx, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored == nil || stored.AccessToken != "token-1" {
+		t.Fatalf("stored token = %+v, want token-1", stored)
+	}
+}
@@ -0,0 +1,64 @@
+package hms
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNewAuthError(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		want   AuthError
+	}{
+		{
+			name:   "string code",
+			status: http.StatusBadRequest,
+			body:   `{"error":"invalid_client","error_description":"wrong secret"}`,
+			want:   AuthError{StatusCode: http.StatusBadRequest, Code: "invalid_client", Description: "wrong secret", Permanent: true},
+		},
+		{
+			name:   "numeric code",
+			status: http.StatusBadRequest,
+			body:   `{"error":1101,"error_description":"invalid client"}`,
+			want:   AuthError{StatusCode: http.StatusBadRequest, Code: "1101", Description: "invalid client", Permanent: true},
+		},
+		{
+			name:   "not json",
+			status: http.StatusForbidden,
+			body:   "  access denied\n",
+			want:   AuthError{StatusCode: http.StatusForbidden, Description: "access denied", Permanent: true},
+		},
+		{
+			name:   "server error",
+			status: http.StatusServiceUnavailable,
+			body:   `{"error":"temporarily_unavailable"}`,
+			want:   AuthError{StatusCode: http.StatusServiceUnavailable, Code: "temporarily_unavailable"},
+		},
+		{
+			name:   "server error with permanent code",
+			status: http.StatusInternalServerError,
+			body:   `{"error":"invalid_grant"}`,
+			want:   AuthError{StatusCode: http.StatusInternalServerError, Code: "invalid_grant", Permanent: true},
+		},
+		{
+			name:   "gateway error page",
+			status: http.StatusBadGateway,
+			body:   "<html>bad gateway</html>",
+			want:   AuthError{StatusCode: http.StatusBadGateway, Description: "<html>bad gateway</html>"},
+		},
+	}
+
+	for _, tt := range tests {
+		got := newAuthError(tt.status, strings.NewReader(tt.body))
+		if !reflect.DeepEqual(*got, tt.want) {
+			t.Errorf("%s: auth error = %+v, want %+v", tt.name, *got, tt.want)
+		}
+		if got.IsPermanent() != tt.want.Permanent {
+			t.Errorf("%s: IsPermanent = %v, want %v", tt.name, got.IsPermanent(), tt.want.Permanent)
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package hms
+
+import (
+	"context"
+	"sync/atomic"
+)
+
+// Span attribute keys set by client and transport
+const (
+	AttrAppId        = "hms.app_id"
+	AttrTargetType   = "hms.target_type"
+	AttrTokenCount   = "hms.token_count"
+	AttrResponseCode = "hms.response_code"
+	AttrRequestId    = "hms.request_id"
+	AttrRetryCount   = "hms.retry_count"
+	AttrAttempt      = "hms.attempt"
+	AttrHTTPMethod   = "http.method"
+	AttrHTTPURL      = "http.url"
+	AttrHTTPStatus   = "http.status_code"
+)
+
+// Tracer starts spans of client operations. It mirrors OpenTelemetry tracer,
+// so adapter to OpenTelemetry SDK is a thin wrapper
+type Tracer interface {
+	// Start creates span which is child of span from ctx and returns context containing new span
+	Start(ctx context.Context, spanName string) (context.Context, Span)
+}
+
+// Span represents single traced operation
+type Span interface {
+	SetAttributes(attrs ...Attribute)
+	RecordError(err error)
+	End()
+}
+
+// Attribute is key-value pair describing span. Value is string, int, bool or float64
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+func Attr(key string, value interface{}) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// nopTracer starts spans which record nothing, it's used when tracer isn't set
+type nopTracer struct{}
+
+func (nopTracer) Start(ctx context.Context, spanName string) (context.Context, Span) {
+	return ctx, nopSpan{}
+}
+
+type nopSpan struct{}
+
+func (nopSpan) SetAttributes(attrs ...Attribute) {}
+func (nopSpan) RecordError(err error)            {}
+func (nopSpan) End()                             {}
+
+// retryCounterKey is context key of counter of http retries made while sending message
+type retryCounterKey struct{}
+
+func withRetryCounter(ctx context.Context) (context.Context, *int32) {
+	counter := new(int32)
+	return context.WithValue(ctx, retryCounterKey{}, counter), counter
+}
+
+func incRetryCounter(ctx context.Context) {
+	if counter, ok := ctx.Value(retryCounterKey{}).(*int32); ok {
+		atomic.AddInt32(counter, 1)
+	}
+}
+
+// messageTargetType returns which kind of target message is sent to
+func messageTargetType(message *Message) string {
+	switch {
+	case message.Token != nil:
+		return "token"
+	case message.Topic != "":
+		return "topic"
+	case message.Condition != "":
+		return "condition"
+	}
+	return ""
+}
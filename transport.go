@@ -4,11 +4,12 @@ import (
 	"bytes"
 	"context"
 	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"io"
 	"io/ioutil"
 	"net/http"
-	"net/url"
+	"strconv"
 	"time"
 )
 
@@ -18,6 +19,13 @@ const (
 
 	DefaultRetryCount      int = 5
 	DefaultRetryIntervalMs int = 0
+
+	// bounds of exponential backoff used by default client transport
+	DefaultRetryBaseInterval = 100 * time.Millisecond
+	DefaultRetryMaxInterval  = 5 * time.Second
+
+	// DefaultMaxRetryAfter is max delay taken from Retry-After header of throttled response
+	DefaultMaxRetryAfter = 30 * time.Second
 )
 
 type HttpRequest struct {
@@ -96,48 +104,264 @@ type HttpResponse struct {
 	Body   io.ReadCloser
 }
 
+// RetryInfo describes failed attempt of request which is going to be retried
+type RetryInfo struct {
+	// Number of failed attempt, starts from 1.
+	Attempt int
+
+	// HTTP status of failed attempt, zero if request failed before getting response.
+	Status int
+
+	// Error of failed attempt, nil if server responded.
+	Err error
+
+	// Delay before next attempt.
+	Delay time.Duration
+
+	// Indicates that delay was taken from Retry-After header of response.
+	RetryAfter bool
+}
+
+// RetryHook is called before waiting for next attempt of request
+type RetryHook func(ctx context.Context, info RetryInfo)
+
 type HttpTransport struct {
-	client        *http.Client
+	client *http.Client
+	// transport of client, used to configure TLS
+	transport *http.Transport
+	// root CAs pool created by AddRootCAs, pools passed by caller are never modified
+	ownRootCAs    *x509.CertPool
 	maxRetryTimes int
-	retryInterval time.Duration
+	backoff       BackoffPolicy
+	// max time spent on all attempts of request including waiting between them, zero means no limit
+	maxRetryDuration time.Duration
+	// max delay taken from Retry-After header
+	maxRetryAfter time.Duration
+	retryHook     RetryHook
+	logger        Logger
+	metrics       Metrics
+	tracer        Tracer
+	// optional circuit breaker checked before every attempt
+	circuitBreaker *CircuitBreaker
 }
 
-func NewHTTPTransport(retryCount int, retryIntervalMs int) (*HttpTransport, error) {
+// NewTransport creates transport configured with options. By default it retries
+// failed requests DefaultRetryCount times with exponential backoff and verifies server certificates
+func NewTransport(opts ...TransportOption) (*HttpTransport, error) {
 	tr := &http.Transport{
 		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: true,
+			MinVersion: tls.VersionTLS12,
 		},
 	}
 
-	client := &http.Client{Transport: tr}
+	transport := &HttpTransport{
+		client:        &http.Client{Transport: tr},
+		transport:     tr,
+		maxRetryTimes: DefaultRetryCount,
+		backoff:       NewExponentialBackoff(DefaultRetryBaseInterval, DefaultRetryMaxInterval),
+		maxRetryAfter: DefaultMaxRetryAfter,
+		logger:        nopLogger{},
+		metrics:       nopMetrics{},
+		tracer:        nopTracer{},
+	}
 
-	return &HttpTransport{
-		client:        client,
-		maxRetryTimes: retryCount,
-		retryInterval: time.Duration(retryIntervalMs) * time.Millisecond,
-	}, nil
+	for _, opt := range opts {
+		if err := opt(transport); err != nil {
+			return nil, err
+		}
+	}
+
+	return transport, nil
+}
+
+// NewHTTPTransport creates transport which verifies server certificates with system root CAs.
+// Retries wait constant interval, exponential backoff is used if interval isn't positive
+func NewHTTPTransport(retryCount int, retryIntervalMs int) (*HttpTransport, error) {
+	return NewTransport(
+		TransportRetryCount(retryCount),
+		TransportBackoff(intervalBackoff(retryIntervalMs)),
+	)
 }
 
 func NewHTTPTransportWithProxy(retryCount int, retryIntervalMs int, proxyUrl string) (*HttpTransport, error) {
-	proxy, err := url.Parse(proxyUrl)
+	return NewTransport(
+		TransportRetryCount(retryCount),
+		TransportBackoff(intervalBackoff(retryIntervalMs)),
+		TransportProxy(proxyUrl),
+	)
+}
+
+// intervalBackoff returns backoff for retry interval passed to legacy constructors.
+// Zero interval means default, retrying without delay only adds load to recovering server
+func intervalBackoff(retryIntervalMs int) BackoffPolicy {
+	if retryIntervalMs <= 0 {
+		return NewExponentialBackoff(DefaultRetryBaseInterval, DefaultRetryMaxInterval)
+	}
+	return NewConstantBackoff(time.Duration(retryIntervalMs) * time.Millisecond)
+}
+
+// SetTLSConfig replaces TLS configuration of transport with copy of provided config
+func (tr *HttpTransport) SetTLSConfig(config *tls.Config) error {
+	if config == nil {
+		return errors.New("passed empty tls config")
+	}
+
+	if tr.transport == nil {
+		return errors.New("tls config of custom http client can't be changed")
+	}
+	tr.transport.TLSClientConfig = config.Clone()
+
+	return nil
+}
+
+// AddRootCAs adds PEM encoded certificates to root CAs trusted by transport in addition to system ones.
+// Root CAs pool of passed TLS config or http client isn't modified, certificates must be added to it by caller
+func (tr *HttpTransport) AddRootCAs(pemCerts []byte) error {
+	tlsConfig, err := tr.tlsConfig()
 	if err != nil {
-		return nil, errors.New("fail parse proxy url")
+		return err
 	}
 
-	tr := &http.Transport{
-		Proxy: http.ProxyURL(proxy),
-		TLSClientConfig: &tls.Config{
-			InsecureSkipVerify: true,
-		},
+	if tlsConfig.RootCAs == nil {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		tlsConfig.RootCAs = pool
+		tr.ownRootCAs = pool
 	}
 
-	client := &http.Client{Transport: tr}
+	// pool could be shared with other users of passed config
+	if tlsConfig.RootCAs != tr.ownRootCAs {
+		return errors.New("root CAs of passed tls config can't be modified")
+	}
 
-	return &HttpTransport{
-		client:        client,
-		maxRetryTimes: retryCount,
-		retryInterval: time.Duration(retryIntervalMs) * time.Millisecond,
-	}, nil
+	if !tlsConfig.RootCAs.AppendCertsFromPEM(pemCerts) {
+		return errors.New("no certificates found in pem data")
+	}
+
+	return nil
+}
+
+// SetClientCertificates sets certificates presented to server for mutual TLS authentication
+func (tr *HttpTransport) SetClientCertificates(certs ...tls.Certificate) error {
+	if len(certs) == 0 {
+		return errors.New("passed empty client certificates")
+	}
+
+	tlsConfig, err := tr.tlsConfig()
+	if err != nil {
+		return err
+	}
+	tlsConfig.Certificates = certs
+
+	return nil
+}
+
+// DisableTLSVerificationForTesting turns off verification of server certificates.
+// It makes connection vulnerable to man-in-the-middle attacks and must be used only in test environments
+func (tr *HttpTransport) DisableTLSVerificationForTesting() error {
+	tlsConfig, err := tr.tlsConfig()
+	if err != nil {
+		return err
+	}
+	tlsConfig.InsecureSkipVerify = true
+
+	return nil
+}
+
+// tlsConfig returns TLS config of underlying transport
+func (tr *HttpTransport) tlsConfig() (*tls.Config, error) {
+	if tr.transport == nil {
+		return nil, errors.New("tls config of custom http client can't be changed")
+	}
+
+	if tr.transport.TLSClientConfig == nil {
+		tr.transport.TLSClientConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+
+	return tr.transport.TLSClientConfig, nil
+}
+
+// SetBackoffPolicy sets policy which decides how long to wait before retrying failed request
+func (tr *HttpTransport) SetBackoffPolicy(backoff BackoffPolicy) error {
+	if backoff == nil {
+		return errors.New("passed empty backoff policy")
+	}
+	tr.backoff = backoff
+
+	return nil
+}
+
+// SetMaxRetryDuration limits total time of all request attempts. Request isn't retried
+// if waiting before next attempt exceeds the limit. Zero disables the limit
+func (tr *HttpTransport) SetMaxRetryDuration(duration time.Duration) error {
+	if duration < 0 {
+		return errors.New("max retry duration can't be negative")
+	}
+	tr.maxRetryDuration = duration
+
+	return nil
+}
+
+// SetMaxRetryAfter sets max delay taken from Retry-After header of throttled or unavailable server response
+func (tr *HttpTransport) SetMaxRetryAfter(max time.Duration) error {
+	if max < 0 {
+		return errors.New("max retry after can't be negative")
+	}
+	tr.maxRetryAfter = max
+
+	return nil
+}
+
+// SetLogger sets logger of request attempts and retries
+func (tr *HttpTransport) SetLogger(logger Logger) error {
+	if logger == nil {
+		return errors.New("passed empty logger")
+	}
+	tr.logger = logger
+
+	return nil
+}
+
+// SetMetrics sets collector of request attempts and retries measurements
+func (tr *HttpTransport) SetMetrics(metrics Metrics) error {
+	if metrics == nil {
+		return errors.New("passed empty metrics")
+	}
+	tr.metrics = metrics
+
+	return nil
+}
+
+// SetTracer sets tracer which creates span for every request attempt
+func (tr *HttpTransport) SetTracer(tracer Tracer) error {
+	if tracer == nil {
+		return errors.New("passed empty tracer")
+	}
+	tr.tracer = tracer
+
+	return nil
+}
+
+// SetCircuitBreaker sets circuit breaker which stops sending requests while server is unavailable
+func (tr *HttpTransport) SetCircuitBreaker(cb *CircuitBreaker) error {
+	if cb == nil {
+		return errors.New("passed empty circuit breaker")
+	}
+	tr.circuitBreaker = cb
+
+	return nil
+}
+
+// SetRetryHook sets hook which is called before every retry of request
+func (tr *HttpTransport) SetRetryHook(hook RetryHook) error {
+	if hook == nil {
+		return errors.New("passed empty retry hook")
+	}
+	tr.retryHook = hook
+
+	return nil
 }
 
 func (tr *HttpTransport) send(req *http.Request) (*HttpResponse, error) {
@@ -158,38 +382,139 @@ func (tr *HttpTransport) Send(ctx context.Context, request *HttpRequest) (result
 		return nil, errors.New("provided nil context")
 	}
 
-	req, err := request.AddContext(ctx).Build()
-	if err != nil {
-		return nil, err
-	}
+	request.AddContext(ctx)
 
-	for retryTimes := 0; retryTimes < tr.maxRetryTimes; retryTimes++ {
-		result, err = tr.send(req)
+	// rate limiter of client request, adapted after every attempt
+	limiter := requestLimiterFrom(ctx)
 
+	start := time.Now()
+	var delay time.Duration
+	for attempt := 1; ; attempt++ {
+		// request body is consumed by every attempt, so request is built again for each of them
+		req, buildErr := request.Build()
+		if buildErr != nil {
+			return nil, buildErr
+		}
+
+		result, err = tr.attempt(ctx, req, attempt)
+		if err == nil && limiter != nil {
+			limiter.report(result.Status)
+		}
+
+		// server is known to be unavailable, retrying is pointless
+		if err == ErrCircuitOpen {
+			return nil, err
+		}
+
+		// check response code on throttling and 500 range errors from server
+		if err == nil && !tr.isRetryStatusCode(result.Status) {
+			break
+		}
+
+		// last response is returned to caller as is
+		if attempt >= tr.maxRetryTimes || tr.isContextDone(ctx) {
+			break
+		}
+
+		delay = tr.backoff.Backoff(attempt, delay)
+		info := RetryInfo{Attempt: attempt, Err: err}
 		if err == nil {
-			// check response code and on 500 range errors from server
-			if !tr.isRetryStatusCode(result.Status) {
-				break
+			info.Status = result.Status
+
+			// server knows better when it will be ready to accept request
+			if retryAfter, ok := parseRetryAfter(result.Header.Get("Retry-After"), time.Now()); ok {
+				if retryAfter > tr.maxRetryAfter {
+					retryAfter = tr.maxRetryAfter
+				}
+
+				if retryAfter > delay {
+					delay = retryAfter
+					info.RetryAfter = true
+				}
 			}
+		}
+		info.Delay = delay
 
+		if tr.maxRetryDuration > 0 && time.Since(start)+delay > tr.maxRetryDuration {
+			break
+		}
+
+		incRetryCounter(ctx)
+		tr.metrics.IncRetry(info.Status)
+		tr.logger.Warn("retrying request", "method", request.Method, "url", request.URL, "attempt", info.Attempt, "status", info.Status, "error", info.Err, "delay", info.Delay)
+		if tr.retryHook != nil {
+			tr.retryHook(ctx, info)
+		}
+
+		if err == nil {
 			// clear result body so we can reuse existing connection for next retry
 			if err = tr.drainBody(result.Body); err != nil {
-				break
+				return nil, err
 			}
 		}
 
-		// check status of context. if context done - stop executing and return result
-		if tr.isContextDone(ctx) {
-			break
+		// wait some time to allow server to recover
+		if err = tr.wait(ctx, delay); err != nil {
+			return nil, err
 		}
 
-		// wait some time to allow server to recover
-		time.Sleep(tr.retryInterval)
+		// retries are limited as well as first attempt which is limited by client
+		if limiter != nil {
+			if err = limiter.limiter.Wait(ctx); err != nil {
+				return nil, err
+			}
+		}
 	}
 
 	return result, err
 }
 
+// attempt sends request once, recording its span, metrics and logs
+func (tr *HttpTransport) attempt(ctx context.Context, req *http.Request, attempt int) (*HttpResponse, error) {
+	_, span := tr.tracer.Start(ctx, "hms.HTTPAttempt")
+	defer span.End()
+	span.SetAttributes(
+		Attr(AttrHTTPMethod, req.Method),
+		Attr(AttrHTTPURL, req.URL.String()),
+		Attr(AttrAttempt, attempt),
+	)
+
+	cb := tr.circuitBreaker
+	if cb != nil && !cb.applies(req.URL.String()) {
+		cb = nil
+	}
+
+	if cb != nil {
+		if err := cb.allow(); err != nil {
+			span.RecordError(err)
+			return nil, err
+		}
+	}
+
+	start := time.Now()
+	result, err := tr.send(req)
+	if cb != nil {
+		// cancellation by caller says nothing about server health
+		if errors.Is(err, context.Canceled) {
+			cb.release()
+		} else {
+			cb.record(!cb.isFailure(result, err))
+		}
+	}
+
+	if err != nil {
+		span.RecordError(err)
+		tr.metrics.ObserveRequest(0, time.Since(start))
+		tr.logger.Debug("request attempt failed", "method", req.Method, "url", req.URL.String(), "attempt", attempt, "error", err, "duration", time.Since(start))
+		return nil, err
+	}
+
+	span.SetAttributes(Attr(AttrHTTPStatus, result.Status))
+	tr.metrics.ObserveRequest(result.Status, time.Since(start))
+	tr.logger.Debug("request attempt completed", "method", req.Method, "url", req.URL.String(), "attempt", attempt, "status", result.Status, "duration", time.Since(start))
+	return result, nil
+}
+
 func (tr *HttpTransport) drainBody(body io.ReadCloser) error {
 	defer body.Close()
 	_, err := io.Copy(ioutil.Discard, io.LimitReader(body, respReadLimit))
@@ -197,7 +522,44 @@ func (tr *HttpTransport) drainBody(body io.ReadCloser) error {
 }
 
 func (tr *HttpTransport) isRetryStatusCode(status int) bool {
-	return status == 0 || status >= 500
+	return status == 0 || status == http.StatusTooManyRequests || status >= 500
+}
+
+// parseRetryAfter parses Retry-After header value which is either number of seconds or HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+
+	if delay := date.Sub(now); delay > 0 {
+		return delay, true
+	}
+	return 0, true
+}
+
+// wait sleeps for delay or until context is done
+func (tr *HttpTransport) wait(ctx context.Context, delay time.Duration) error {
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
 }
 
 func (tr *HttpTransport) isContextDone(ctx context.Context) bool {
@@ -0,0 +1,334 @@
+package hms
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestTransportRetrySendsFullBody(t *testing.T) {
+	const attempts = 4
+	payload := `{"validate_only":false,"message":{"token":["token"],"data":"payload"}}`
+
+	var (
+		mu     sync.Mutex
+		bodies []string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			t.Errorf("read body: %v", err)
+		}
+
+		mu.Lock()
+		bodies = append(bodies, string(body))
+		attempt := len(bodies)
+		mu.Unlock()
+
+		if attempt < attempts {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Write([]byte(`{"code":"80000000"}`))
+	}))
+	defer server.Close()
+
+	tr, err := NewTransport(TransportRetryCount(attempts), TransportBackoff(NewConstantBackoff(0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	req := NewHTTPRequest().
+		SetMethod(http.MethodPost).
+		SetURL(server.URL).
+		SetStringBody(payload)
+
+	resp, err := tr.Send(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.Status != http.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.Status, http.StatusOK)
+	}
+
+	if len(bodies) != attempts {
+		t.Fatalf("server received %d attempts, want %d", len(bodies), attempts)
+	}
+
+	for i, body := range bodies {
+		if body != payload {
+			t.Errorf("attempt %d body = %q, want %q", i+1, body, payload)
+		}
+	}
+}
+
+func TestTransportOptionsDontModifyPassedClient(t *testing.T) {
+	passed := &http.Transport{}
+	client := &http.Client{Transport: passed}
+
+	_, err := NewTransport(
+		TransportHTTPClient(client),
+		TransportDisableTLSVerificationForTesting(),
+		TransportProxy("http://proxy.example.com:3128"),
+		TransportTimeout(time.Second),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if client.Transport != passed {
+		t.Fatal("transport of passed client was replaced")
+	}
+	if passed.TLSClientConfig != nil && passed.TLSClientConfig.InsecureSkipVerify {
+		t.Fatal("tls verification of passed transport was disabled")
+	}
+	if passed.Proxy != nil {
+		t.Fatal("proxy of passed transport was set")
+	}
+	if client.Timeout != 0 {
+		t.Fatal("timeout of passed client was set")
+	}
+}
+
+func TestTransportSetTLSConfigCopiesConfig(t *testing.T) {
+	tr, err := NewTransport()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	config := &tls.Config{MinVersion: tls.VersionTLS13, RootCAs: pool}
+	if err := tr.SetTLSConfig(config); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tr.DisableTLSVerificationForTesting(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tr.AddRootCAs(testCertPEM(t)); err == nil {
+		t.Fatal("expected error for root CAs of passed tls config")
+	}
+
+	if config.InsecureSkipVerify {
+		t.Fatal("passed tls config was modified")
+	}
+	if n := len(pool.Subjects()); n != 0 {
+		t.Fatalf("passed root CAs pool has %d certificates, want 0", n)
+	}
+	if tr.transport.TLSClientConfig.MinVersion != tls.VersionTLS13 {
+		t.Fatal("tls config wasn't applied")
+	}
+}
+
+// testCertPEM returns PEM encoded self-signed certificate
+func testCertPEM(t *testing.T) []byte {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "hms test ca"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+		IsCA:         true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func TestTransportRootCAsDontModifyPassedClientPool(t *testing.T) {
+	cert := testCertPEM(t)
+
+	pool := x509.NewCertPool()
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	if _, err := NewTransport(TransportHTTPClient(client), TransportRootCAs(cert)); err == nil {
+		t.Fatal("expected error for root CAs of passed http client")
+	}
+
+	if n := len(pool.Subjects()); n != 0 {
+		t.Fatalf("passed pool has %d certificates, want 0", n)
+	}
+
+	// pool created by transport itself can be extended
+	tr, err := NewTransport(TransportRootCAs(cert), TransportRootCAs(testCertPEM(t)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tr.transport.TLSClientConfig.RootCAs == nil {
+		t.Fatal("root CAs weren't set")
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, time.January, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value string
+		delay time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"0", 0, true},
+		{"120", 2 * time.Minute, true},
+		{"-1", 0, false},
+		{"soon", 0, false},
+		{now.Add(30 * time.Second).Format(http.TimeFormat), 30 * time.Second, true},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+	}
+
+	for _, tt := range tests {
+		delay, ok := parseRetryAfter(tt.value, now)
+		if delay != tt.delay || ok != tt.ok {
+			t.Errorf("parseRetryAfter(%q) = %v, %v, want %v, %v", tt.value, delay, ok, tt.delay, tt.ok)
+		}
+	}
+}
+
+func TestTransportRetryAfter(t *testing.T) {
+	tests := []struct {
+		name          string
+		retryAfter    string
+		maxRetryAfter time.Duration
+		delay         time.Duration
+		fromHeader    bool
+	}{
+		{"seconds", "1", time.Minute, time.Second, true},
+		{"capped", "3600", 200 * time.Millisecond, 200 * time.Millisecond, true},
+		{"past date", time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), time.Minute, 10 * time.Millisecond, false},
+		{"missing", "", time.Minute, 10 * time.Millisecond, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if atomic.AddInt32(&requests, 1) == 1 {
+					if tt.retryAfter != "" {
+						w.Header().Set("Retry-After", tt.retryAfter)
+					}
+					w.WriteHeader(http.StatusTooManyRequests)
+					return
+				}
+				w.Write([]byte(`{"code":"80000000"}`))
+			}))
+			defer server.Close()
+
+			var infos []RetryInfo
+			tr, err := NewTransport(
+				TransportRetryCount(2),
+				TransportBackoff(NewConstantBackoff(10*time.Millisecond)),
+				TransportMaxRetryAfter(tt.maxRetryAfter),
+				TransportRetryHook(func(ctx context.Context, info RetryInfo) {
+					infos = append(infos, info)
+				}),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			resp, err := tr.Send(context.Background(), NewHTTPRequest().SetMethod(http.MethodPost).SetURL(server.URL))
+			if err != nil {
+				t.Fatal(err)
+			}
+			resp.Body.Close()
+
+			if resp.Status != http.StatusOK || requests != 2 {
+				t.Fatalf("status = %d after %d requests, want 200 after 2", resp.Status, requests)
+			}
+
+			want := []RetryInfo{{Attempt: 1, Status: http.StatusTooManyRequests, Delay: tt.delay, RetryAfter: tt.fromHeader}}
+			if !reflect.DeepEqual(infos, want) {
+				t.Fatalf("retry infos = %+v, want %+v", infos, want)
+			}
+		})
+	}
+}
+
+func TestTransportMaxRetryDuration(t *testing.T) {
+	var requests int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	tr, err := NewTransport(
+		TransportRetryCount(10),
+		TransportBackoff(NewConstantBackoff(100*time.Millisecond)),
+		TransportMaxRetryDuration(250*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := tr.Send(context.Background(), NewHTTPRequest().SetMethod(http.MethodPost).SetURL(server.URL))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	// the third retry would end after the limit
+	if resp.Status != http.StatusServiceUnavailable || requests != 3 {
+		t.Fatalf("status = %d after %d requests, want 503 after 3", resp.Status, requests)
+	}
+}
+
+func TestTransportWaitStopsOnContextDone(t *testing.T) {
+	tr, err := NewTransport()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(10*time.Millisecond, cancel)
+
+	start := time.Now()
+	if err := tr.wait(ctx, time.Minute); err != context.Canceled {
+		t.Fatalf("wait error = %v, want %v", err, context.Canceled)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Fatalf("wait returned after %v", elapsed)
+	}
+
+	// canceled retry wait fails request instead of returning retried response
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer server.Close()
+
+	tr, err = NewTransport(TransportRetryCount(3), TransportBackoff(NewConstantBackoff(time.Minute)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := tr.Send(ctx, NewHTTPRequest().SetMethod(http.MethodPost).SetURL(server.URL)); err != context.DeadlineExceeded {
+		t.Fatalf("Send error = %v, want %v", err, context.DeadlineExceeded)
+	}
+}